@@ -7,6 +7,7 @@ import (
 
 type Node interface {
 	Pos() Position
+	Comments() (string, string)
 	fmt.Stringer
 
 	isEmpty() bool
@@ -18,6 +19,13 @@ type comment struct {
 	post string
 }
 
+// Comments gives the comment written on the lines before the node (pre) and
+// the one written at the end of its line (post). Comments of consecutive lines
+// are joined with newlines. The leading # and the blanks after it are removed.
+func (c *comment) Comments() (string, string) {
+	return c.pre, c.post
+}
+
 func (c *comment) isZero() bool {
 	return c.pre == "" && c.post == ""
 }
@@ -41,6 +49,17 @@ func (o *Option) Pos() Position {
 	return o.key.Pos
 }
 
+// Key gives the key of the option. The last segment is given for dotted keys.
+func (o *Option) Key() string {
+	return o.key.Literal
+}
+
+// Value gives the value of the option: a Literal, an Array or an (inline)
+// Table.
+func (o *Option) Value() Node {
+	return o.value
+}
+
 func (o *Option) isEmpty() bool {
 	return o.value == nil || o.value.isEmpty()
 }
@@ -58,6 +77,11 @@ func (i *Literal) Pos() Position {
 	return i.token.Pos
 }
 
+// Token gives the token of the literal with its raw and decoded values.
+func (i *Literal) Token() Token {
+	return i.token
+}
+
 func (i *Literal) isEmpty() bool {
 	return false
 }
@@ -96,6 +120,16 @@ func (a *Array) Append(n Node) {
 	a.nodes = append(a.nodes, n)
 }
 
+// Len gives the number of elements of the array.
+func (a *Array) Len() int {
+	return len(a.nodes)
+}
+
+// At gives the element of the array at index i. It panics if i is out of range.
+func (a *Array) At(i int) Node {
+	return a.nodes[i]
+}
+
 type tableType int8
 
 const (
@@ -135,10 +169,23 @@ type Table struct {
 	comment
 	key  Token
 	kind tableType
+	// dotted is set when the table has only been defined by dotted keys
+	dotted bool
+	// raw is the source of the table from the line after its header to the
+	// next header
+	raw string
+	// eol is the end of line of the document, only set for the root table
+	eol string
 
 	nodes []Node
 }
 
+// hasSource reports whether the table has been defined by a header. Only these
+// tables have their source recorded by the parser.
+func (t *Table) hasSource() bool {
+	return !t.dotted && (t.kind == tableRegular || t.kind == tableItem)
+}
+
 func (t *Table) String() string {
 	return t.key.Literal
 }
@@ -147,6 +194,71 @@ func (t *Table) Pos() Position {
 	return t.key.Pos
 }
 
+// Key gives the key of the table. It is empty for the root table and for inline
+// tables.
+func (t *Table) Key() string {
+	return t.key.Literal
+}
+
+// EOL gives the end of line ("\n" or "\r\n") used by most of the lines of the
+// parsed document. It is only set for the root table.
+func (t *Table) EOL() string {
+	return t.eol
+}
+
+// IsArray reports whether the table is an array of tables. Its items are given
+// by Tables.
+func (t *Table) IsArray() bool {
+	return t.isArray()
+}
+
+// Keys gives the keys of the options and of the sub tables of t in the order
+// they appear in the document. It gives nothing for an array of tables.
+func (t *Table) Keys() []string {
+	if t.isArray() {
+		return nil
+	}
+	var (
+		options = t.listOptions()
+		tables  = t.listTables()
+		keys    = make([]string, 0, len(t.nodes))
+	)
+	for len(options) > 0 || len(tables) > 0 {
+		if len(tables) == 0 || (len(options) > 0 && options[0].Pos().Less(tables[0].Pos())) {
+			keys = append(keys, options[0].Key())
+			options = options[1:]
+		} else {
+			keys = append(keys, tables[0].Key())
+			tables = tables[1:]
+		}
+	}
+	return keys
+}
+
+// Get gives the option or the sub table of t with the given key. Keys are not
+// split on dots: each segment of a dotted key is a table of its own.
+func (t *Table) Get(key string) (Node, bool) {
+	if t.isArray() {
+		return nil, false
+	}
+	at := searchNodes(key, t.nodes)
+	if at >= len(t.nodes) || t.nodes[at].String() != key {
+		return nil, false
+	}
+	return t.nodes[at], true
+}
+
+// Options gives the options of t in the order they appear in the document.
+func (t *Table) Options() []*Option {
+	return t.listOptions()
+}
+
+// Tables gives the sub tables of t (or the items of an array of tables) in the
+// order they appear in the document.
+func (t *Table) Tables() []*Table {
+	return t.listTables()
+}
+
 func (t *Table) isEmpty() bool {
 	return len(t.nodes) == 0
 }
@@ -189,7 +301,7 @@ func (t *Table) retrieveTable(tok Token) (*Table, error) {
 		switch x := t.nodes[at].(type) {
 		case *Option:
 			if x.key.Literal == tok.Literal {
-				return nil, fmt.Errorf("%s: option", tok.Literal)
+				return nil, fmt.Errorf("%s: option already exists (at %s)", tok.Literal, x.Pos())
 			}
 		case *Table:
 			if x.key.Literal != tok.Literal {
@@ -219,24 +331,32 @@ func (t *Table) registerTable(n *Table) error {
 		switch x := t.nodes[at].(type) {
 		case *Option:
 			if x.key.Literal == n.key.Literal {
-				return fmt.Errorf("%s: option already exists", n.key.Literal)
+				return fmt.Errorf("%s: option already exists (at %s)", n.key.Literal, x.Pos())
 			}
 		case *Table:
 			if x.key.Literal != n.key.Literal {
 				break
 			}
-			if x.isImplicit() {
-				t.nodes[at] = mergeTables(n, x)
-				return nil
-			}
 			if x.isArray() {
 				if n.kind != tableItem {
-					return fmt.Errorf("%s: invalid table type (%s)", x.key.Literal, n.kind)
+					return redefineTable(x, n)
 				}
 				x.nodes = append(x.nodes, n)
 				return nil
 			}
-			return fmt.Errorf("%s: table already exists", n.key.Literal)
+			if n.kind == tableItem {
+				return redefineTable(x, n)
+			}
+			if x.isImplicit() {
+				t.nodes[at] = mergeTables(n, x)
+				return nil
+			}
+			if x.dotted {
+				return fmt.Errorf("%s: table already defined by dotted keys (at %s)", n.key.Literal, x.Pos())
+			}
+			// implicit tables have been merged above: an explicit table can only
+			// be defined once
+			return fmt.Errorf("%s: table already defined (at %s)", n.key.Literal, x.Pos())
 		default:
 		}
 	}
@@ -257,11 +377,11 @@ func (t *Table) registerOption(o *Option) error {
 		switch x := t.nodes[at].(type) {
 		case *Option:
 			if x.key.Literal == o.key.Literal {
-				return fmt.Errorf("%s: option already exists", x.key.Literal)
+				return fmt.Errorf("%s: option already exists (at %s)", x.key.Literal, x.Pos())
 			}
 		case *Table:
 			if x.key.Literal == o.key.Literal {
-				return fmt.Errorf("%s: table already exists", x.key.Literal)
+				return fmt.Errorf("%s: table already exists (at %s)", x.key.Literal, x.Pos())
 			}
 		default:
 		}
@@ -269,6 +389,7 @@ func (t *Table) registerOption(o *Option) error {
 	t.nodes = appendNode(t.nodes, o, at)
 	if t.isImplicit() {
 		t.kind = tableRegular
+		t.dotted = true
 	}
 	return nil
 }
@@ -285,6 +406,20 @@ func (t *Table) isImplicit() bool {
 	return t.kind == tableImplicit
 }
 
+func redefineTable(curr, next *Table) error {
+	var (
+		prev = "regular table"
+		kind = "regular table"
+	)
+	if curr.isArray() {
+		prev = "array table"
+	}
+	if next.kind == tableItem {
+		kind = "array table"
+	}
+	return fmt.Errorf("%s: cannot redefine %s as %s (originally at %s)", next.key.Literal, prev, kind, curr.Pos())
+}
+
 func mergeTables(t, n *Table) *Table {
 	t.nodes = append(t.nodes, n.nodes...)
 	t.kind = tableRegular
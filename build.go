@@ -0,0 +1,493 @@
+package toml
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FromMap creates the tree of a TOML document from m. Maps become tables,
+// slices of maps become arrays of tables and other values become options. The
+// returned Table can be given to a Formatter to be written as TOML.
+func FromMap(m map[string]interface{}) (*Table, error) {
+	var (
+		b    builder
+		root = &Table{kind: tableRegular}
+	)
+	if err := b.buildTable(root, reflect.ValueOf(m)); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// AppendValue converts v (a string, a boolean, a number or a time.Time) to a
+// literal and appends it to the array.
+func (a *Array) AppendValue(v interface{}) error {
+	val := indirectValue(reflect.ValueOf(v))
+	if !val.IsValid() {
+		return fmt.Errorf("array: nil value can not be appended")
+	}
+	switch k := val.Kind(); {
+	case val.Type() == timeType:
+	case k == reflect.Slice || k == reflect.Array || k == reflect.Map || k == reflect.Struct:
+		return fmt.Errorf("array: %s is not a scalar type", val.Type())
+	}
+	b := a.builder()
+	n, err := b.buildValue(val, fieldTag{})
+	if err != nil {
+		return fmt.Errorf("array: %w", err)
+	}
+	a.Append(n)
+	return nil
+}
+
+// AppendTable converts v (a map with keys of type string or a struct) to an
+// inline table and appends it to the array.
+func (a *Array) AppendTable(v interface{}) error {
+	val := indirectValue(reflect.ValueOf(v))
+	if !val.IsValid() || !isTableValue(val) {
+		return fmt.Errorf("array: %T can not be converted to a table", v)
+	}
+	b := a.builder()
+	n, err := b.buildValue(val, fieldTag{})
+	if err != nil {
+		return fmt.Errorf("array: %w", err)
+	}
+	a.Append(n)
+	return nil
+}
+
+// builder gives a builder that keeps the new nodes on the line of the last
+// node of the array.
+func (a *Array) builder() builder {
+	b := builder{
+		line:   a.pos.Line,
+		column: a.pos.Column,
+		inline: 1,
+	}
+	if n := len(a.nodes); n > 0 {
+		pos := a.nodes[n-1].Pos()
+		b.line, b.column = pos.Line, pos.Column
+	}
+	return b
+}
+
+// builder creates nodes from go values. Each node created receives a new line
+// so that the order of creation is kept when the tree is formatted. Nodes of
+// arrays and inline tables stay on the line of their parent.
+type builder struct {
+	line   int
+	column int
+	inline int
+
+	timefmt string
+	// write slices of tables as arrays of inline tables
+	inlineArrays bool
+}
+
+func (b *builder) pos() Position {
+	if b.inline > 0 {
+		b.column++
+	} else {
+		b.line++
+		b.column = 1
+	}
+	return Position{Line: b.line, Column: b.column}
+}
+
+func (b *builder) enterInline() {
+	b.inline++
+}
+
+func (b *builder) leaveInline() {
+	b.inline--
+}
+
+func (b *builder) key(str string) Token {
+	tok := Token{
+		Literal: str,
+		Type:    TokIdent,
+		Pos:     b.pos(),
+	}
+	if !isBareKey(str) {
+		tok.Type = TokBasic
+	}
+	return tok
+}
+
+func (b *builder) buildTable(t *Table, v reflect.Value) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return fmt.Errorf("table: nil value can not be encoded")
+	}
+	if v.Type() == orderedMapType {
+		m := v.Interface().(OrderedMap)
+		for _, k := range m.keys {
+			if err := b.buildNode(t, k, reflect.ValueOf(m.values[k]), fieldTag{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Struct {
+		for _, f := range listFields(v) {
+			if err := b.buildNode(t, f.name, f.value, f.tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if v.Kind() != reflect.Map || !isString(v.Type().Key().Kind()) {
+		return fmt.Errorf("table: unsupported type %s", v.Type())
+	}
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		if err := b.buildNode(t, k.String(), v.MapIndex(k), fieldTag{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *builder) buildNode(t *Table, key string, v reflect.Value, tag fieldTag) error {
+	v = indirectValue(v)
+	if !v.IsValid() || isNilValue(v) {
+		return nil
+	}
+	switch {
+	case isTableValue(v):
+		x := &Table{
+			key:  b.key(key),
+			kind: tableRegular,
+		}
+		if err := t.registerTable(x); err != nil {
+			return err
+		}
+		return b.buildTable(x, v)
+	case !b.inlineArrays && isArrayTableValue(v):
+		for i := 0; i < v.Len(); i++ {
+			x := &Table{
+				key:  b.key(key),
+				kind: tableItem,
+			}
+			if err := t.registerTable(x); err != nil {
+				return err
+			}
+			if err := b.buildTable(x, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		o := Option{key: b.key(key)}
+		n, err := b.buildValue(v, tag)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		o.value = n
+		return t.registerOption(&o)
+	}
+}
+
+func (b *builder) buildValue(v reflect.Value, tag fieldTag) (Node, error) {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil, fmt.Errorf("nil value can not be encoded")
+	}
+	if m, ok := marshalerOf(v); ok {
+		return b.marshal(m, v.Type())
+	}
+	if v.Type() == timeType {
+		when := v.Interface().(time.Time)
+		layout := b.timefmt
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		return b.literal(when.Format(layout), TokDatetime), nil
+	}
+	if m, ok := textMarshalerOf(v); ok {
+		text, err := m.MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", v.Type(), err)
+		}
+		return b.literal(string(text), TokBasic), nil
+	}
+	switch k := v.Kind(); {
+	case isString(k):
+		return b.literal(v.String(), TokBasic), nil
+	case isBool(k):
+		return b.literal(strconv.FormatBool(v.Bool()), TokBool), nil
+	case isInt(k):
+		return b.integer(strconv.FormatInt(v.Int(), 10), tag)
+	case isUint(k):
+		return b.integer(strconv.FormatUint(v.Uint(), 10), tag)
+	case isFloat(k):
+		return b.literal(formatFloatValue(v.Float()), TokFloat), nil
+	case k == reflect.Slice || k == reflect.Array:
+		a := Array{pos: b.pos()}
+		b.enterInline()
+		defer b.leaveInline()
+		for i := 0; i < v.Len(); i++ {
+			n, err := b.buildValue(v.Index(i), tag)
+			if err != nil {
+				return nil, err
+			}
+			a.Append(n)
+		}
+		return &a, nil
+	case k == reflect.Map || k == reflect.Struct:
+		t := Table{
+			key:  Token{Pos: b.pos()},
+			kind: tableInline,
+		}
+		b.enterInline()
+		defer b.leaveInline()
+		if err := b.buildTable(&t, v); err != nil {
+			return nil, err
+		}
+		return &t, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+// integer creates an integer literal written in the base requested by the
+// options of the field: hex, oct or bin. Decimal is used by default.
+func (b *builder) integer(str string, tag fieldTag) (Node, error) {
+	var (
+		base   int
+		prefix string
+	)
+	switch {
+	case tag.has("hex"):
+		base, prefix = 16, "0x"
+	case tag.has("oct"):
+		base, prefix = 8, "0o"
+	case tag.has("bin"):
+		base, prefix = 2, "0b"
+	default:
+		return b.literal(str, TokInteger), nil
+	}
+	if strings.HasPrefix(str, "-") {
+		return nil, fmt.Errorf("%s: negative integer can not be written in base %d", str, base)
+	}
+	str, err := formatInteger(base, 0, prefix)(str)
+	if err != nil {
+		return nil, err
+	}
+	return b.literal(str, TokInteger), nil
+}
+
+// marshal creates a literal from the bytes returned by the MarshalTOML method of
+// m. The bytes should be scanned as a single value.
+func (b *builder) marshal(m Marshaler, typ reflect.Type) (Node, error) {
+	buf, err := m.MarshalTOML()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", typ, err)
+	}
+	tok, err := scanSingleValue(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", typ, err)
+	}
+	tok.Pos = b.pos()
+	return &Literal{token: tok}, nil
+}
+
+func (b *builder) literal(str string, kind rune) *Literal {
+	return &Literal{
+		token: Token{
+			Literal: str,
+			Type:    kind,
+			Pos:     b.pos(),
+		},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// marshalerOf gives the Marshaler implemented by v or by a pointer to v when v
+// is addressable.
+func marshalerOf(v reflect.Value) (Marshaler, bool) {
+	m, ok := implementationOf(v, marshalerType)
+	if !ok {
+		return nil, false
+	}
+	return m.(Marshaler), true
+}
+
+// textMarshalerOf gives the encoding.TextMarshaler implemented by v or by a
+// pointer to v when v is addressable.
+func textMarshalerOf(v reflect.Value) (encoding.TextMarshaler, bool) {
+	m, ok := implementationOf(v, textMarshalerType)
+	if !ok {
+		return nil, false
+	}
+	return m.(encoding.TextMarshaler), true
+}
+
+func implementationOf(v reflect.Value, typ reflect.Type) (interface{}, bool) {
+	if v.Type().Implements(typ) && v.CanInterface() {
+		return v.Interface(), true
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(typ) && v.Addr().CanInterface() {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// scanSingleValue scans buf as the value of an option and gives its token. It
+// fails if buf contains anything else than a string, a number, a boolean or a
+// date/time.
+func scanSingleValue(buf []byte) (Token, error) {
+	s, err := NewScanner(bytes.NewReader(append([]byte("value = "), buf...)))
+	if err != nil {
+		return Token{}, err
+	}
+	var toks []Token
+	for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+		if tok.Type != TokNL {
+			toks = append(toks, tok)
+		}
+	}
+	if len(toks) != 3 || !toks[2].IsValue() {
+		return Token{}, fmt.Errorf("%q: invalid TOML value", buf)
+	}
+	return toks[2], nil
+}
+
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isNilValue reports whether v is a nil map or a nil slice. There is nothing to
+// write for such values so they are omitted.
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+func isTableValue(v reflect.Value) bool {
+	if _, ok := marshalerOf(v); ok {
+		return false
+	}
+	if _, ok := textMarshalerOf(v); ok {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		return true
+	case reflect.Struct:
+		return v.Type() != timeType
+	default:
+		return false
+	}
+}
+
+type structField struct {
+	name  string
+	tag   fieldTag
+	value reflect.Value
+	field reflect.StructField
+}
+
+// listFields gives the exported fields of v in their declaration order. Fields
+// of embedded structs without tag are listed as if they were fields of v.
+func listFields(v reflect.Value) []structField {
+	var (
+		typ = v.Type()
+		fs  []structField
+	)
+	for i := 0; i < v.NumField(); i++ {
+		var (
+			tf  = typ.Field(i)
+			tag = parseTag(tf.Tag.Get("toml"))
+			f   = v.Field(i)
+		)
+		if tf.PkgPath != "" && !tf.Anonymous {
+			continue
+		}
+		if tf.Anonymous && tag.name == "" {
+			if e := indirectValue(f); e.Kind() == reflect.Struct {
+				fs = append(fs, listFields(e)...)
+			}
+			continue
+		}
+		if tag.skip() {
+			continue
+		}
+		if tag.name == "" {
+			tag.name = strings.ToLower(tf.Name)
+		}
+		fs = append(fs, structField{
+			name:  tag.name,
+			tag:   tag,
+			value: f,
+			field: tf,
+		})
+	}
+	return fs
+}
+
+func isArrayTableValue(v reflect.Value) bool {
+	if k := v.Kind(); !(k == reflect.Slice || k == reflect.Array) || v.Len() == 0 {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if !isTableValue(indirectValue(v.Index(i))) {
+			return false
+		}
+	}
+	return true
+}
+
+func isBareKey(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, r := range str {
+		if !isAlpha(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatFloatValue(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	str := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eE") {
+		str += ".0"
+	}
+	return str
+}
@@ -0,0 +1,70 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFromMap(t *testing.T) {
+	when := time.Date(2019, 10, 24, 19, 7, 54, 0, time.UTC)
+	in := map[string]interface{}{
+		"package":  "toml",
+		"revision": int64(18),
+		"ratio":    float64(2),
+		"stable":   true,
+		"released": when,
+		"provides": []interface{}{"toml", "tomllint"},
+		"inline":   []interface{}{map[string]interface{}{"a": int64(1)}, int64(2)},
+		"dev": map[string]interface{}{
+			"name":   "midbel",
+			"e-mail": "noreply@midbel.org",
+			"project": []interface{}{
+				map[string]interface{}{"repository": "glob", "active": true},
+				map[string]interface{}{"repository": "maestro", "active": false},
+			},
+		},
+	}
+	root, err := FromMap(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		d   Decoder
+		out = make(map[string]interface{})
+	)
+	if err := d.decodeMap(root, reflect.ValueOf(out)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("maps mismatched:\nwant: %#v\ngot:  %#v", in, out)
+	}
+	if _, err := FromMap(map[string]interface{}{"chan": make(chan int)}); err == nil {
+		t.Errorf("unsupported type not detected")
+	}
+}
+
+func TestArrayAppendValue(t *testing.T) {
+	var a Array
+	for _, v := range []interface{}{"toml", 42, 3.14, true, time.Date(2019, 10, 24, 19, 7, 54, 0, time.UTC)} {
+		if err := a.AppendValue(v); err != nil {
+			t.Fatalf("%v: unexpected error: %s", v, err)
+		}
+	}
+	if err := a.AppendTable(map[string]interface{}{"name": "midbel"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `["toml", 42, 3.14, true, 2019-10-24T19:07:54Z, {name = "midbel"}]`
+	if got := strings.TrimSpace(String(&a)); got != want {
+		t.Errorf("array not written properly:\nwant: %s\ngot:  %s", want, got)
+	}
+	for _, v := range []interface{}{nil, []int{1}, struct{}{}, make(chan int)} {
+		if err := a.AppendValue(v); err == nil {
+			t.Errorf("%T: unsupported value not detected", v)
+		}
+	}
+	if err := a.AppendTable(42); err == nil {
+		t.Errorf("unsupported table not detected")
+	}
+}
@@ -0,0 +1,138 @@
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Date is a local date (eg: 1979-05-27): a date without time and time zone.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf gives the date of t in its location.
+func DateOf(t time.Time) Date {
+	var d Date
+	d.Year, d.Month, d.Day = t.Date()
+	return d
+}
+
+// In gives the time at midnight of the date in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// MarshalTOML writes d as a TOML local date.
+func (d Date) MarshalTOML() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Time is a local time (eg: 07:32:00.999999): a time of day without date and
+// time zone.
+type Time struct {
+	Hour       int
+	Minute     int
+	Second     int
+	Nanosecond int
+}
+
+// TimeOf gives the time of day of t in its location.
+func TimeOf(t time.Time) Time {
+	var c Time
+	c.Hour, c.Minute, c.Second = t.Clock()
+	c.Nanosecond = t.Nanosecond()
+	return c
+}
+
+func (t Time) String() string {
+	when := time.Date(0, 1, 1, t.Hour, t.Minute, t.Second, t.Nanosecond, time.UTC)
+	return when.Format(timeFormat + ".999999999")
+}
+
+// MarshalTOML writes t as a TOML local time.
+func (t Time) MarshalTOML() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// DateTime is a local date time (eg: 1979-05-27T07:32:00): a date and a time
+// without time zone.
+type DateTime struct {
+	Date Date
+	Time Time
+}
+
+// DateTimeOf gives the date and the time of t in its location.
+func DateTimeOf(t time.Time) DateTime {
+	return DateTime{
+		Date: DateOf(t),
+		Time: TimeOf(t),
+	}
+}
+
+// In gives the time of dt in loc.
+func (dt DateTime) In(loc *time.Location) time.Time {
+	var (
+		d = dt.Date
+		t = dt.Time
+	)
+	return time.Date(d.Year, d.Month, d.Day, t.Hour, t.Minute, t.Second, t.Nanosecond, loc)
+}
+
+func (dt DateTime) String() string {
+	return dt.Date.String() + "T" + dt.Time.String()
+}
+
+// MarshalTOML writes dt as a TOML local date time.
+func (dt DateTime) MarshalTOML() ([]byte, error) {
+	return []byte(dt.String()), nil
+}
+
+var (
+	dateType      = reflect.TypeOf(Date{})
+	timeOfDayType = reflect.TypeOf(Time{})
+	dateTimeType  = reflect.TypeOf(DateTime{})
+)
+
+func decodeDate(e reflect.Value, str string) error {
+	when, err := time.Parse(dateFormat, str)
+	if err != nil {
+		return err
+	}
+	e.Set(reflect.ValueOf(DateOf(when)))
+	return nil
+}
+
+func decodeTimeOfDay(e reflect.Value, str string) error {
+	when, err := time.Parse(timeFormat, str)
+	if err != nil {
+		return err
+	}
+	e.Set(reflect.ValueOf(TimeOf(when)))
+	return nil
+}
+
+// decodeDateTime decodes a local date time. Offset date times are rejected
+// since the offset would be lost.
+func decodeDateTime(e reflect.Value, str string) error {
+	if len(str) <= len(dateFormat) {
+		return fmt.Errorf("datetime(%s): invalid local datetime", str)
+	}
+	if strings.ContainsAny(str[len(dateFormat)+1:], "Zz+-") {
+		return fmt.Errorf("datetime(%s): offset datetime to local datetime", str)
+	}
+	str = str[:len(dateFormat)] + "T" + str[len(dateFormat)+1:]
+	when, err := time.Parse(dtFormat1, str)
+	if err != nil {
+		return err
+	}
+	e.Set(reflect.ValueOf(DateTimeOf(when)))
+	return nil
+}
@@ -4,17 +4,26 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
 
 	"github.com/midbel/toml"
 )
 
 const help = `tomlfmt re writes a toml document.
 
+usage: tomlfmt [options] <file...>
+
+When file is "-", the document is read from stdin and written to stdout.
+
 options:
 
   -a  FMT   rewrite array(s) according to FMT
+  -A  NUM   write arrays with more than NUM elements on multiple lines (overrides -a)
+  -D        print a diff of the changes instead of the formatted document
+            (upper case since -d is the integer base)
+  -c  COLS  wrap multiline strings at COLS columns (0 to disable wrapping)
   -d  FMT   use FMT as base when rewritting integers
   -e  EOL   use EOL when writing the end of line
   -f  FMT   use FMT to rewrite floats
@@ -22,13 +31,24 @@ options:
   -h        print this help message and exit
   -i        rewrite (array of) inline table(s) to (array of) regular table(s)
   -k        keep empty table(s) when rewritting document
+  -l        list files whose formatting differs instead of the formatted document
   -m  PREC  use PREC as millisecond precision for datetime values
   -n        nest sub tables with indentation
   -o        remove comments from document
+  -p        keep multiline strings as written in the document
+  -q  FMT   quote keys according to FMT
   -r        keep raw values
   -s  SPACE use SPACE space(s) as indent instead of tab
+  -t        sort options and tables by keys (arrays of tables keep their order)
   -u  NUM   insert underscore in number (integer/float) every NUM characters
-  -w        overwrite source file
+  -w        overwrite source file (ignored when reading from stdin)
+
+Exit status:
+
+* 0: all files have been formatted
+* 1: with -l or -D, the formatting of at least one file differs (files are not
+modified)
+* 2: a file can not be read, parsed or formatted
 
 Array format:
 
@@ -50,6 +70,12 @@ Float format:
 * e: floats will be written in scientific notation
 * g: floats will be written, depending of their values, to normal or scientific notation
 
+Key quoting:
+
+* preserve (default): keys are quoted as they are in the original document
+* minimal: only keys that can not be written bare are quoted
+* all: all keys are quoted
+
 End of Line:
 
 * lf: use line feed as end of line terminator
@@ -59,18 +85,24 @@ End of Line:
 
 func main() {
 	flag.Usage = func() {
-		fmt.Fprintln(os.Stdout, help)
+		fmt.Fprint(os.Stdout, help)
 		os.Exit(2)
 	}
 	var (
 		overwrite = flag.Bool("w", false, "overwrite document")
+		list      = flag.Bool("l", false, "list files whose formatting differs")
+		diff      = flag.Bool("D", false, "print diff of changes")
 		// general option
 		raw   = flag.Bool("r", false, "keep raw values")
 		keep  = flag.Bool("k", false, "keep empty table(s)")
 		nest  = flag.Bool("n", false, "nest sub table(s)")
 		space = flag.Int("s", 0, "use space for indentation instead of tab")
 		nocom = flag.Bool("o", false, "ignore comment(s)")
-		eol   = flag.String("e", "", "end of line")
+		eol   = flag.String("e", "", "end of line (default: same as document)")
+		wrap  = flag.Int("c", 72, "wrap multiline strings")
+		multi = flag.Bool("p", false, "preserve multiline strings")
+		quote = flag.String("q", "", "quote keys")
+		order = flag.Bool("t", false, "sort options and tables by keys")
 		// time formatting options
 		utc    = flag.Bool("g", false, "convert local date time to UTC date time")
 		millis = flag.Int("m", 0, "use given millis precision")
@@ -80,6 +112,7 @@ func main() {
 		underscore = flag.Int("u", 0, "insert underscore in number (float/integer)")
 		// array/inline formatting option
 		array  = flag.String("a", "", "write array on multiple/single line(s)")
+		limit  = flag.Int("A", -1, "write array with more than limit elements on multiple lines")
 		inline = flag.Bool("i", false, "convert inline table(s) to regular table(s)")
 	)
 	flag.Parse()
@@ -95,25 +128,78 @@ func main() {
 		toml.WithInline(*inline),
 		toml.WithEOL(*eol),
 		toml.WithRaw(*raw),
+		toml.WithWrapWidth(*wrap),
+		toml.WithPreserveMultiline(*multi),
+		toml.WithKeyQuoting(*quote),
+		toml.WithSortKeys(*order),
+	}
+	if *limit >= 0 {
+		rules = append(rules, toml.WithArrayThreshold(*limit))
 	}
+	var changed, failed bool
 	for _, a := range flag.Args() {
-		if err := formatDocument(a, *overwrite, rules); err != nil {
+		src, out, err := formatDocument(a, rules)
+		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
 		}
+		if *list || *diff {
+			if bytes.Equal(src, out) {
+				continue
+			}
+			changed = true
+			if *list {
+				fmt.Fprintln(os.Stdout, a)
+			}
+			if *diff {
+				if err := diffDocument(a, src, out); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					failed = true
+				}
+			}
+			continue
+		}
+		if err := writeDocument(a, *overwrite, out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+		}
+	}
+	switch {
+	case failed:
+		os.Exit(2)
+	case changed:
+		os.Exit(1)
 	}
 }
 
-func formatDocument(doc string, overwrite bool, rules []toml.FormatRule) error {
-	ft, err := toml.NewFormatter(doc, rules...)
+func formatDocument(doc string, rules []toml.FormatRule) ([]byte, []byte, error) {
+	var (
+		src []byte
+		err error
+	)
+	if doc == "-" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(doc)
+	}
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	ft, err := toml.NewFormatterReader(bytes.NewReader(src), rules...)
+	if err != nil {
+		return nil, nil, err
 	}
 	var buf bytes.Buffer
 	if err := ft.Format(&buf); err != nil {
-		return err
+		return nil, nil, err
 	}
+	return src, buf.Bytes(), nil
+}
+
+func writeDocument(doc string, overwrite bool, buf []byte) error {
 	out := os.Stdout
-	if overwrite {
+	if overwrite && doc != "-" {
 		w, err := os.Create(doc)
 		if err != nil {
 			return err
@@ -121,6 +207,44 @@ func formatDocument(doc string, overwrite bool, rules []toml.FormatRule) error {
 		defer w.Close()
 		out = w
 	}
-	_, err = io.Copy(out, &buf)
+	_, err := out.Write(buf)
 	return err
 }
+
+func diffDocument(doc string, src, out []byte) error {
+	old, err := writeTemp(src)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(old)
+	cur, err := writeTemp(out)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(cur)
+
+	cmd := exec.Command("diff", "-u", "--label", doc+".orig", "--label", doc, old, cur)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// diff exits with 1 when the files differ
+		if e, ok := err.(*exec.ExitError); ok && e.ExitCode() == 1 {
+			return nil
+		}
+		return fmt.Errorf("%s: diff: %w", doc, err)
+	}
+	return nil
+}
+
+func writeTemp(buf []byte) (string, error) {
+	w, err := ioutil.TempFile("", "tomlfmt-*.toml")
+	if err != nil {
+		return "", err
+	}
+	defer w.Close()
+	if _, err := w.Write(buf); err != nil {
+		os.Remove(w.Name())
+		return "", err
+	}
+	return w.Name(), nil
+}
@@ -18,7 +18,7 @@ func main() {
 	}
 	defer r.Close()
 
-	s, err := toml.NewScanner(r)
+	s, err := toml.NewStreamScanner(r)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(3)
@@ -26,4 +26,8 @@ func main() {
 	for k := s.Scan(); k.Type != toml.TokEOF; k = s.Scan() {
 		fmt.Println(k)
 	}
+	if err := s.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
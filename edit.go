@@ -0,0 +1,157 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Document is a parsed TOML document that keeps its source. Set replaces only
+// the bytes of the value of an option in the source so that the rest of the
+// document (layout, comments, numbers written in other bases,...) is kept as
+// it is.
+type Document struct {
+	src  []byte
+	crlf bool
+	root *Table
+}
+
+// ParseDocument parses the TOML document from r and keeps its source to be
+// edited.
+func ParseDocument(r io.Reader) (*Document, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var d Document
+	if bytes.Contains(buf, []byte("\r\n")) {
+		d.crlf = true
+		buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+	}
+	if err := d.reset(buf); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Root gives the root table of the document. The tree is rebuilt after each
+// call to Set.
+func (d *Document) Root() *Table {
+	return d.root
+}
+
+// Set replaces the value of the option found at the given dotted key by v (a
+// string, a boolean, a number or a time.Time). Only options with a literal
+// value can be set.
+func (d *Document) Set(key string, v interface{}) error {
+	lit, err := d.lookup(key)
+	if err != nil {
+		return err
+	}
+	var b builder
+	n, err := b.buildValue(reflect.ValueOf(v), fieldTag{})
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if _, ok := n.(*Literal); !ok {
+		return fmt.Errorf("%s: %T is not a scalar type", key, v)
+	}
+	var (
+		beg = d.offset(lit.Pos())
+		end = beg + len(lit.token.Raw)
+	)
+	if end > len(d.src) || string(d.src[beg:end]) != lit.token.Raw {
+		return fmt.Errorf("%s: value not found in source", key)
+	}
+	src := make([]byte, 0, len(d.src))
+	src = append(src, d.src[:beg]...)
+	src = append(src, String(n)...)
+	src = append(src, d.src[end:]...)
+	return d.reset(src)
+}
+
+// Bytes gives the source of the document with the values that have been set.
+func (d *Document) Bytes() []byte {
+	if d.crlf {
+		return bytes.ReplaceAll(d.src, []byte("\n"), []byte("\r\n"))
+	}
+	return append([]byte{}, d.src...)
+}
+
+// WriteTo writes the source of the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.Bytes())
+	return int64(n), err
+}
+
+func (d *Document) reset(src []byte) error {
+	n, err := Parse(bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+	root, ok := n.(*Table)
+	if !ok {
+		return fmt.Errorf("root node is not a table!") // should never happen
+	}
+	d.src, d.root = src, root
+	return nil
+}
+
+func (d *Document) lookup(key string) (*Literal, error) {
+	keys, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	t := d.root
+	for i, k := range keys {
+		n, ok := t.Get(k)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w option", key, ErrUndefined)
+		}
+		if i == len(keys)-1 {
+			o, ok := n.(*Option)
+			if !ok {
+				return nil, fmt.Errorf("%s: not an option", key)
+			}
+			lit, ok := o.value.(*Literal)
+			if !ok {
+				return nil, fmt.Errorf("%s: only literal values can be set", key)
+			}
+			return lit, nil
+		}
+		switch n := n.(type) {
+		case *Table:
+			t = n
+		case *Option:
+			t, ok = n.value.(*Table)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s is not a table", key, k)
+			}
+		}
+		if t.isArray() {
+			return nil, fmt.Errorf("%s: %s is an array of tables", key, k)
+		}
+	}
+	return nil, fmt.Errorf("%s: empty key", key)
+}
+
+// offset converts pos to the offset of the same character in the source.
+// Columns are counted in runes.
+func (d *Document) offset(pos Position) int {
+	var offset int
+	for line := 1; line < pos.Line; line++ {
+		i := bytes.IndexByte(d.src[offset:], '\n')
+		if i < 0 {
+			return len(d.src)
+		}
+		offset += i + 1
+	}
+	for col := 1; col < pos.Column && offset < len(d.src); col++ {
+		_, n := utf8.DecodeRune(d.src[offset:])
+		offset += n
+	}
+	return offset
+}
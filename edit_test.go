@@ -0,0 +1,69 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentSet(t *testing.T) {
+	const doc = `# package description
+package  = "toml"   # name
+version  = "1.0.0"
+revision = 0x12
+ratio    = 1_000.5e-3
+released = 1979-05-27T07:32:00Z
+
+[dev]
+name  = 'midbel'
+email = "noreply@midbel.org"
+owner = {name = "midbel", site = "https://github.com/midbel"}
+`
+	d, err := ParseDocument(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("version", "1.1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("dev.owner.site", "https://midbel.org"); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		want = strings.Split(doc, "\n")
+		got  = strings.Split(string(d.Bytes()), "\n")
+	)
+	want[2] = `version  = "1.1.0"`
+	want[10] = `owner = {name = "midbel", site = "https://midbel.org"}`
+	if len(got) != len(want) {
+		t.Fatalf("lines count mismatched: want %d, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d mismatched: want %q, got %q", i+1, want[i], got[i])
+		}
+	}
+
+	for _, key := range []string{"license", "dev", "dev.owner", "dev.name.first"} {
+		if err := d.Set(key, "MIT"); err == nil {
+			t.Errorf("%s: value should not be set", key)
+		}
+	}
+	if err := d.Set("revision", []int{1, 2}); err == nil {
+		t.Errorf("non scalar value should not be set")
+	}
+}
+
+func TestDocumentSetCRLF(t *testing.T) {
+	const doc = "name = \"toml\"\r\nversion = \"1.0.0\"\r\n"
+	d, err := ParseDocument(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("name", "tomlfmt"); err != nil {
+		t.Fatal(err)
+	}
+	want := "name = \"tomlfmt\"\r\nversion = \"1.0.0\"\r\n"
+	if got := string(d.Bytes()); got != want {
+		t.Errorf("document mismatched: want %q, got %q", want, got)
+	}
+}
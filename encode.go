@@ -0,0 +1,110 @@
+package toml
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+)
+
+// Marshal returns the TOML encoding of v. v should be a struct or a map with
+// keys of type string (or a pointer to one of them). Nested structs and maps
+// are written as tables and slices of structs or maps as arrays of tables.
+//
+// Nil pointers, maps and slices are omitted since there is nothing to write for
+// them. Empty tables (from an empty map or a struct without fields) are not
+// written unless requested with Encoder.SetKeepEmpty.
+//
+// Keys of maps are written in lexical order so that the output is the same
+// between calls. Fields of struct are encoded in their declaration order using
+// the same toml tag as Decode. In addition to the name of the option, the tag
+// accepts the options hex, oct and bin to write an integer in the given base.
+//
+// Values implementing Marshaler write their own representation. Values
+// implementing encoding.TextMarshaler are written as strings.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Marshaler is implemented by types that can write themselves as a TOML value.
+//
+// The bytes returned by MarshalTOML are used as is for the value of the option.
+// They should be a single TOML value: a string (with its quotes), a number, a
+// boolean or a date/time. Values spanning several tokens (arrays or inline
+// tables) are rejected. Otherwise, writing a valid TOML value is the
+// responsibility of the implementation.
+type Marshaler interface {
+	MarshalTOML() ([]byte, error)
+}
+
+// Encoder writes the TOML encoding of go values to an output stream.
+type Encoder struct {
+	w io.Writer
+
+	timefmt string
+	empty   bool
+	inline  bool
+	nest    bool
+	indent  int
+	eol     string
+}
+
+// Create a new Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Tell the encoder the layout (as expected by time.Format) to use to write
+// time.Time values. By default, times are written following RFC 3339.
+func (e *Encoder) SetTimeFormat(layout string) {
+	e.timefmt = layout
+}
+
+// Tell the encoder to write the header of tables without options.
+func (e *Encoder) SetKeepEmpty(keep bool) {
+	e.empty = keep
+}
+
+// Tell the encoder to write slices of maps and structs as arrays of inline
+// tables instead of arrays of tables.
+func (e *Encoder) SetInlineArrays(inline bool) {
+	e.inline = inline
+}
+
+// Tell the encoder to indent sub tables. The indentation is made of n spaces or
+// a tab when n is 0.
+func (e *Encoder) SetIndent(n int) {
+	e.nest = true
+	e.indent = n
+}
+
+// Tell the encoder which end of line to use: "lf" (the default) or "crlf". See
+// WithEOL for the accepted values.
+func (e *Encoder) SetEOL(eol string) {
+	e.eol = eol
+}
+
+// Encode writes the TOML encoding of v to the stream. See Marshal for the
+// details about the conversion of go values.
+func (e *Encoder) Encode(v interface{}) error {
+	var (
+		b    = builder{timefmt: e.timefmt, inlineArrays: e.inline}
+		root = &Table{kind: tableRegular}
+	)
+	if err := b.buildTable(root, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	f, err := newFormatter(root,
+		WithEmpty(e.empty),
+		WithNest(e.nest),
+		WithTab(e.indent),
+		WithEOL(e.eol),
+	)
+	if err != nil {
+		return err
+	}
+	return f.Format(e.w)
+}
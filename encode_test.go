@@ -0,0 +1,381 @@
+package toml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalIntegerBase(t *testing.T) {
+	type Perm struct {
+		Mask  uint32 `toml:"mask,hex"`
+		Mode  int    `toml:"mode,oct"`
+		Flags []int  `toml:"flags,bin"`
+		Count int    `toml:"count"`
+	}
+	in := Perm{
+		Mask:  0xff,
+		Mode:  0755,
+		Flags: []int{1, 2, 4},
+		Count: 10,
+	}
+	buf, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"mask  = 0xff", "mode  = 0o755", "flags = [0b1, 0b10, 0b100]", "count = 10"} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("%q not found in\n%s", want, buf)
+		}
+	}
+	var out Perm
+	if err := Decode(bytes.NewReader(buf), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Mask != in.Mask || out.Mode != in.Mode || out.Count != in.Count || len(out.Flags) != len(in.Flags) {
+		t.Errorf("values mismatched: want %+v, got %+v", in, out)
+	}
+	neg := struct {
+		Mask int `toml:"mask,hex"`
+	}{Mask: -1}
+	if _, err := Marshal(neg); err == nil {
+		t.Errorf("negative hexadecimal integer not detected")
+	}
+}
+
+func TestMarshalSortedMap(t *testing.T) {
+	in := map[string]interface{}{
+		"zeta":  1,
+		"alpha": 2,
+		"mid":   []interface{}{map[string]interface{}{"z": 1, "a": 2, "m": 3}},
+		"inline": []interface{}{
+			map[string]interface{}{"y": true, "b": false},
+			"value",
+		},
+		"table": map[string]interface{}{"d": 4, "c": 3, "b": map[string]interface{}{"y": 1, "x": 2}},
+	}
+	want, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		got, err := Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Fatalf("output differs between calls:\n%s\n%s", want, got)
+		}
+	}
+	keys := []string{"alpha", "inline = [{b = false, y = true}", "zeta", "[[mid]]", "a", "m", "z", "[table]", "c", "d", "[table.b]", "x", "y"}
+	str := string(want)
+	for _, k := range keys {
+		x := strings.Index(str, k)
+		if x < 0 {
+			t.Fatalf("%s not found or not in order in\n%s", k, want)
+		}
+		str = str[x+len(k):]
+	}
+}
+
+func TestOrderedMapRoundTrip(t *testing.T) {
+	const sample = `zeta    = 1
+alpha   = "first"
+numbers = [3, 1, 2]
+
+[server]
+port = 80
+host = "localhost"
+
+[[plugin]]
+name    = "z"
+enabled = true
+
+[[plugin]]
+name    = "a"
+enabled = false
+
+[client]
+user = "midbel"
+`
+	m := NewOrderedMap()
+	if err := Decode(strings.NewReader(sample), m); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zeta", "alpha", "numbers", "server", "plugin", "client"}
+	if got := m.Keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("keys mismatched: want %v, got %v", want, got)
+	}
+	v, _ := m.Get("server")
+	server, ok := v.(*OrderedMap)
+	if !ok {
+		t.Fatalf("sub table should be decoded into OrderedMap, got %T", v)
+	}
+	if got := server.Keys(); len(got) != 2 || got[0] != "port" || got[1] != "host" {
+		t.Fatalf("keys of sub table mismatched: %v", got)
+	}
+	server.Set("port", 8080)
+
+	buf, err := Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Replace(sample, "port = 80\n", "port = 8080\n", 1)
+	if strings.TrimSpace(string(buf)) != strings.TrimSpace(out) {
+		t.Errorf("document mismatched:\nwant:\n%s\ngot:\n%s", out, buf)
+	}
+}
+
+func TestEncoderTimeFormat(t *testing.T) {
+	v := struct {
+		When time.Time
+	}{
+		When: time.Date(2021, 5, 12, 10, 30, 15, 123456789, time.UTC),
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetTimeFormat("2006-01-02T15:04:05.000Z07:00")
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	want := "when = 2021-05-12T10:30:15.123Z"
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("time not formatted properly: want %q, got %q", want, got)
+	}
+}
+
+func TestMarshalNilValues(t *testing.T) {
+	type Sub struct {
+		Name string
+	}
+	v := struct {
+		Name  string
+		Ptr   *Sub
+		Map   map[string]string
+		Tags  []string
+		Empty map[string]string
+	}{
+		Name:  "toml",
+		Empty: map[string]string{},
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(buf)), `name = "toml"`; got != want {
+		t.Errorf("nil values not omitted: want %q, got %q", want, got)
+	}
+
+	var w bytes.Buffer
+	e := NewEncoder(&w)
+	e.SetKeepEmpty(true)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	got := w.String()
+	if !strings.Contains(got, "[empty]") {
+		t.Errorf("empty table not written: %q", got)
+	}
+	for _, str := range []string{"ptr", "map", "tags"} {
+		if strings.Contains(got, str) {
+			t.Errorf("nil value %s written: %q", str, got)
+		}
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	var p Package
+	if err := decodeFile(&p); err != nil {
+		t.Fatal(err)
+	}
+	p.Logs = append(p.Logs, Changelog{
+		Author: "midbel",
+		Text:   "quote \" backslash \\ tab \t\nnewline",
+		When:   time.Date(2019, 10, 23, 12, 0, 0, 0, time.UTC),
+	})
+	buf, err := Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Package
+	if err := Decode(bytes.NewReader(buf), &got); err != nil {
+		t.Fatalf("fail to decode marshaled package: %s\n%s", err, buf)
+	}
+	if !reflect.DeepEqual(p, got) {
+		t.Errorf("package mismatched:\nwant: %+v\ngot:  %+v", p, got)
+	}
+}
+
+func TestEncoderIndentEOL(t *testing.T) {
+	type Project struct {
+		Name string
+	}
+	type Dev struct {
+		Name    string
+		Project Project
+	}
+	v := struct {
+		Name string
+		Dev  Dev
+	}{
+		Name: "toml",
+		Dev:  Dev{Name: "midbel", Project: Project{Name: "glob"}},
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	e.SetIndent(2)
+	e.SetEOL("crlf")
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	want := "name = \"toml\"\r\n\r\n[dev]\r\nname = \"midbel\"\r\n\r\n  [dev.project]\r\n  name = \"glob\"\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("document mismatched: want %q, got %q", want, got)
+	}
+
+	e.SetEOL("cr")
+	if err := e.Encode(v); err == nil {
+		t.Errorf("unsupported end of line should be rejected")
+	}
+}
+
+type rgb struct {
+	R, G, B uint8
+}
+
+func (c rgb) MarshalTOML() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"#%02x%02x%02x\"", c.R, c.G, c.B)), nil
+}
+
+type duration time.Duration
+
+func (d *duration) MarshalTOML() ([]byte, error) {
+	return []byte(strconv.Quote(time.Duration(*d).String())), nil
+}
+
+type badValue string
+
+func (b badValue) MarshalTOML() ([]byte, error) {
+	return []byte(b), nil
+}
+
+func TestMarshalMarshaler(t *testing.T) {
+	v := struct {
+		Color   rgb
+		Palette []rgb
+		Timeout duration
+	}{
+		Color:   rgb{R: 255},
+		Palette: []rgb{{G: 255}, {B: 255}},
+		Timeout: duration(90 * time.Minute),
+	}
+	buf, err := Marshal(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "color   = \"#ff0000\"\npalette = [\"#00ff00\", \"#0000ff\"]\ntimeout = \"1h30m0s\""
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	for _, str := range []string{"[1, 2]", "1 2", "\"a\" = 1", "{a = 1}", ""} {
+		v := struct {
+			Value badValue
+		}{
+			Value: badValue(str),
+		}
+		if _, err := Marshal(v); err == nil {
+			t.Errorf("%q: invalid value not rejected", str)
+		}
+	}
+}
+
+func TestMarshalTextMarshaler(t *testing.T) {
+	v := struct {
+		Addr  net.IP
+		Peers []net.IP
+	}{
+		Addr:  net.IPv4(192, 168, 1, 1),
+		Peers: []net.IP{net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)},
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "addr  = \"192.168.1.1\"\npeers = [\"10.0.0.1\", \"10.0.0.2\"]"
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestMarshalCivilTypes(t *testing.T) {
+	when := time.Date(1979, 5, 27, 7, 32, 0, 500000000, time.UTC)
+	v := struct {
+		Date     Date
+		Time     Time
+		DateTime DateTime
+	}{
+		Date:     DateOf(when),
+		Time:     TimeOf(when),
+		DateTime: DateTimeOf(when),
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "date     = 1979-05-27\ntime     = 07:32:00.5\ndatetime = 1979-05-27T07:32:00.5"
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, got)
+	}
+	if got := v.DateTime.In(time.UTC); !got.Equal(when) {
+		t.Errorf("time mismatched: want %s, got %s", when, got)
+	}
+}
+
+func TestEncoderArrayTables(t *testing.T) {
+	const doc = `{
+	"name": "toml",
+	"dependency": [
+		{"repository": "https://github.com/midbel/glob", "version": "0.0.0"},
+		{"repository": "https://github.com/midbel/toml", "version": "0.1.0"}
+	]
+}`
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name = "toml"
+
+[[dependency]]
+repository = "https://github.com/midbel/glob"
+version    = "0.0.0"
+
+[[dependency]]
+repository = "https://github.com/midbel/toml"
+version    = "0.1.0"`
+	if got := strings.TrimSpace(string(buf)); got != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	var w bytes.Buffer
+	e := NewEncoder(&w)
+	e.SetInlineArrays(true)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	want = `dependency = [{repository = "https://github.com/midbel/glob", version = "0.0.0"}, {repository = "https://github.com/midbel/toml", version = "0.1.0"}]
+name       = "toml"`
+	if got := strings.TrimSpace(w.String()); got != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, got)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -68,6 +69,50 @@ func WithInline(inline bool) FormatRule {
 	}
 }
 
+// Tell the formatter to write the tables without sub tables and with less than n
+// options as inline tables in their parent table. Tables with comments on their
+// options are kept as they are. A value of 0 or less disables it, as well as
+// WithInline.
+func WithCollapse(n int) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withCollapse = n
+		return nil
+	}
+}
+
+// Tell the formatter to write the options and the sub tables of each table sorted
+// by their keys instead of in the order of the document. The items of arrays of
+// tables keep their order, only their own options and sub tables are sorted.
+func WithSortKeys(sort bool) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withSort = sort
+		return nil
+	}
+}
+
+// Tell the formatter how to align the "=" of the options. "table" (the default)
+// aligns them with the longest key of each table, "none" writes a single space
+// after each key and "document" aligns them with the longest key of the whole
+// document. "inline" is like "table" but the tables created from inline tables
+// (see WithInline) are aligned with the keys of the table they come from.
+func WithAlign(mode string) FormatRule {
+	return func(ft *Formatter) error {
+		switch strings.ToLower(mode) {
+		case "", "table":
+			ft.withAlign = alignTable
+		case "none":
+			ft.withAlign = alignNone
+		case "document":
+			ft.withAlign = alignDocument
+		case "inline":
+			ft.withAlign = alignInline
+		default:
+			return fmt.Errorf("%s: unsupported alignment", mode)
+		}
+		return nil
+	}
+}
+
 // Tell the formatter how to reformat arrays. By default, array with 0 or 1 element
 // will always be written on the same line.
 func WithArray(format string) FormatRule {
@@ -86,6 +131,88 @@ func WithArray(format string) FormatRule {
 	}
 }
 
+// Tell the formatter to write a comma after the last element of arrays written on
+// multiple lines (the default). Arrays written on a single line never end with a
+// comma.
+func WithTrailingComma(with bool) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withComma = with
+		return nil
+	}
+}
+
+// Tell the formatter to write arrays with more than n elements on multiple lines
+// and the others on a single line, whatever their layout in the original document.
+func WithArrayThreshold(n int) FormatRule {
+	return func(ft *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("%d: invalid array threshold", n)
+		}
+		ft.withArray = arrayThreshold
+		ft.withThreshold = n
+		return nil
+	}
+}
+
+// Tell the formatter to write arrays on a single line only when the line would
+// not be longer than n characters (indentation and key included), on multiple
+// lines otherwise. Inline tables are always written on a single line as TOML
+// requires but their length counts for the arrays containing them. A width of 0
+// means no limit. Indentation is counted as one column per character, so a tab
+// counts for one column.
+//
+// WithWidth replaces the layout of the arrays. It can not be combined with
+// WithArray (except "mixed") or WithArrayThreshold.
+func WithWidth(n int) FormatRule {
+	return func(ft *Formatter) error {
+		if n < 0 {
+			return fmt.Errorf("%d: invalid width", n)
+		}
+		ft.withWidth = n
+		return nil
+	}
+}
+
+// Tell the formatter how to write keys. "preserve" (the default) keeps the
+// quoting of the original document, "minimal" only quotes keys that can not be
+// written bare and "all" quotes every keys.
+func WithKeyQuoting(format string) FormatRule {
+	return func(ft *Formatter) error {
+		switch strings.ToLower(format) {
+		case "", "preserve":
+			ft.withQuote = keyPreserve
+		case "minimal":
+			ft.withQuote = keyMinimal
+		case "all":
+			ft.withQuote = keyAll
+		default:
+			return fmt.Errorf("%s: unsupported key quoting", format)
+		}
+		return nil
+	}
+}
+
+// Tell the formatter how to quote strings. "preserve" (the default) keeps the
+// quoting of the original document, "basic" writes all strings as basic strings
+// (double quotes) and "literal" writes strings as literal strings (single quotes)
+// when they can be written without escape sequences. Strings that can not be
+// written as literal strings remain basic strings.
+func WithStringStyle(style string) FormatRule {
+	return func(ft *Formatter) error {
+		switch strings.ToLower(style) {
+		case "", "preserve":
+			ft.withString = stringPreserve
+		case "basic":
+			ft.withString = stringBasic
+		case "literal":
+			ft.withString = stringLiteral
+		default:
+			return fmt.Errorf("%s: unsupported string style", style)
+		}
+		return nil
+	}
+}
+
 // Tell the formatter to use the precision of millisecond to use and if it is needed
 // to convert offset datetime to UTC.
 func WithTime(millis int, utc bool) FormatRule {
@@ -106,6 +233,13 @@ func WithTime(millis int, utc bool) FormatRule {
 // Tell the formatter how to format floating point number and where to write an
 // underscore to make it more readable (if needed)
 func WithFloat(format string, underscore int) FormatRule {
+	return WithFloatGroups(format, underscore, underscore)
+}
+
+// Tell the formatter how to format floating point number and where to write an
+// underscore in the integer part (grouped from the right) and in the fractional
+// part (grouped from the left) of the number.
+func WithFloatGroups(format string, integer, fraction int) FormatRule {
 	return func(ft *Formatter) error {
 		var spec byte
 		switch strings.ToLower(format) {
@@ -118,7 +252,7 @@ func WithFloat(format string, underscore int) FormatRule {
 		default:
 			return fmt.Errorf("%s: unsupported specifier", format)
 		}
-		ft.floatconv = formatFloat(spec, underscore)
+		ft.floatconv = formatFloat(spec, integer, fraction)
 		return nil
 	}
 }
@@ -148,14 +282,46 @@ func WithNumber(format string, underscore int) FormatRule {
 	}
 }
 
+// Tell the formatter to end the document with exactly one end of line (the
+// default) or with none. Extra empty lines at the end of the document are
+// always removed.
+func WithFinalNewline(with bool) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withFinal = with
+		return nil
+	}
+}
+
+// Tell the formatter the width (in columns) used to wrap multiline strings
+// written on a single line. If cols is 0 or less, strings are not wrapped.
+func WithWrapWidth(cols int) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withWrap = cols
+		return nil
+	}
+}
+
+// Tell the formatter to write multiline strings exactly as they are in the
+// original document: line breaks and line ending backslashes are kept and
+// strings are never wrapped.
+func WithPreserveMultiline(with bool) FormatRule {
+	return func(ft *Formatter) error {
+		ft.withMultiline = with
+		return nil
+	}
+}
+
 // Tell the formatter which sequence of character to use to write the end of line.
+// An empty format keeps the end of line used by the document.
 func WithEOL(format string) FormatRule {
 	return func(ft *Formatter) error {
 		switch strings.ToLower(format) {
 		case "crlf", "windows":
 			ft.withEOL = "\r\n"
-		case "lf", "linux", "":
+		case "lf", "linux":
 			ft.withEOL = "\n"
+		case "":
+			ft.withEOL = ""
 		default:
 			return fmt.Errorf("%s: unsupported eof", format)
 		}
@@ -167,6 +333,26 @@ const (
 	arrayMixed int = iota
 	arraySingle
 	arrayMulti
+	arrayThreshold
+)
+
+const (
+	alignTable int = iota
+	alignNone
+	alignDocument
+	alignInline
+)
+
+const (
+	stringPreserve int = iota
+	stringBasic
+	stringLiteral
+)
+
+const (
+	keyPreserve int = iota
+	keyMinimal
+	keyAll
 )
 
 // Formatter is responsible to rewrite a TOML document according to the settings
@@ -179,24 +365,65 @@ type Formatter struct {
 	intconv   func(string) (string, error)
 	timeconv  func(string) (string, error)
 
-	withArray   int
-	withInline  bool
-	withTab     string
-	withEOL     string
-	withEmpty   bool
-	withComment bool
-	withNest    bool
-	currLevel   int
-	withRaw     bool
+	withArray     int
+	withThreshold int
+	withWidth     int
+	column        int
+	withInline    bool
+	withAlign     int
+	withSort      bool
+	withCollapse  int
+	collapsed     map[*Table]struct{}
+	keyWidth      int
+	withTab       string
+	withEOL       string
+	withEmpty     bool
+	withComment   bool
+	withNest      bool
+	currLevel     int
+	withRaw       bool
+	withWrap      int
+	withMultiline bool
+	withQuote     int
+	withString    int
+	withFinal     bool
+	withComma     bool
 }
 
 // Create a new Formatter that will rewrite the TOML document doc according to the
 // rules specify.
 func NewFormatter(doc string, rules ...FormatRule) (*Formatter, error) {
+	buf, err := ioutil.ReadFile(doc)
+	if err != nil {
+		return nil, err
+	}
+	return NewFormatterReader(bytes.NewReader(buf), rules...)
+}
+
+// Create a new Formatter that will rewrite the TOML document read from r.
+func NewFormatterReader(r io.Reader, rules ...FormatRule) (*Formatter, error) {
+	n, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return newFormatter(n, rules...)
+}
+
+// Create a new Formatter that will write n, a document already parsed or built
+// by other means. Formatting n with WithInline modifies its inline tables.
+func NewFormatterNode(n Node, rules ...FormatRule) (*Formatter, error) {
+	if _, ok := n.(*Table); !ok {
+		return nil, fmt.Errorf("%T: document should be a table", n)
+	}
+	return newFormatter(n, rules...)
+}
+
+func newFormatter(doc Node, rules ...FormatRule) (*Formatter, error) {
 	identity := func(str string) (string, error) {
 		return str, nil
 	}
 	f := Formatter{
+		doc:         doc,
 		floatconv:   identity,
 		intconv:     identity,
 		timeconv:    identity,
@@ -206,57 +433,145 @@ func NewFormatter(doc string, rules ...FormatRule) (*Formatter, error) {
 		withNest:    false,
 		withComment: true,
 		withTab:     "\t",
-		withEOL:     "\n",
 		withRaw:     false,
-	}
-
-	buf, err := ioutil.ReadFile(doc)
-	if err != nil {
-		return nil, err
-	}
-	f.doc, err = Parse(bytes.NewReader(buf))
-	if err != nil {
-		return nil, err
+		withWrap:    72,
+		withFinal:   true,
+		withComma:   true,
 	}
 	for _, rfn := range rules {
 		if err := rfn(&f); err != nil {
 			return nil, err
 		}
 	}
+	if f.withWidth > 0 && f.withArray != arrayMixed {
+		return nil, fmt.Errorf("width can not be combined with an array format or threshold")
+	}
+	if f.withEOL == "" {
+		f.withEOL = "\n"
+		if root, ok := doc.(*Table); ok && root.eol != "" {
+			f.withEOL = root.eol
+		}
+	}
 	return &f, nil
 }
 
 // Reformat the document
 func (f *Formatter) Format(w io.Writer) error {
-	f.writer = bufio.NewWriter(w)
+	tw := trailingWriter{w: w}
+	f.writer = bufio.NewWriter(&tw)
 	root, ok := f.doc.(*Table)
 	if !ok {
 		return fmt.Errorf("document not parsed properly")
 	}
+	if f.withAlign == alignDocument {
+		f.keyWidth = f.longestDocumentKey(root)
+	}
+	if f.withComment && root.comment.pre != "" {
+		f.formatComment(root.comment.pre, true)
+		if len(root.nodes) > 0 {
+			f.endLine()
+		}
+	}
 	if err := f.formatTable(root, nil); err != nil {
 		return err
 	}
-	return f.writer.Flush()
+	if err := f.writer.Flush(); err != nil {
+		return err
+	}
+	if f.withFinal && tw.written {
+		_, err := io.WriteString(w, f.withEOL)
+		return err
+	}
+	return nil
+}
+
+// trailingWriter holds back the end of lines written at the end of a document
+// and only writes them when they are followed by other content.
+type trailingWriter struct {
+	w       io.Writer
+	pending []byte
+	written bool
+}
+
+func (t *trailingWriter) Write(b []byte) (int, error) {
+	n := len(bytes.TrimRight(b, "\r\n"))
+	if n > 0 {
+		if len(t.pending) > 0 {
+			if _, err := t.w.Write(t.pending); err != nil {
+				return 0, err
+			}
+			t.pending = t.pending[:0]
+		}
+		if _, err := t.w.Write(b[:n]); err != nil {
+			return 0, err
+		}
+		t.written = true
+	}
+	t.pending = append(t.pending, b[n:]...)
+	return len(b), nil
+}
+
+// String returns n and its children as TOML text written with the default rules
+// of the Formatter. If n can not be written, the returned string describes the
+// error.
+func String(n Node) string {
+	var (
+		buf    bytes.Buffer
+		f, err = newFormatter(n)
+	)
+	if err != nil {
+		return fmt.Sprintf("<error(%s)>", err)
+	}
+	f.writer = bufio.NewWriter(&buf)
+	switch n := n.(type) {
+	case *Table:
+		if n.kind == tableInline {
+			err = f.formatValue(n)
+			break
+		}
+		err = f.Format(&buf)
+	case *Option:
+		err = f.formatOptions([]*Option{n}, nil)
+	default:
+		err = f.formatValue(n)
+	}
+	if err == nil {
+		err = f.writer.Flush()
+	}
+	if err != nil {
+		return fmt.Sprintf("<error(%s)>", err)
+	}
+	return buf.String()
 }
 
 func (f *Formatter) formatTable(curr *Table, paths []string) error {
-	options := curr.listOptions()
-	if f.withEmpty || len(options) > 0 {
+	var (
+		options = f.listOptions(curr)
+		tables  = f.listTables(curr)
+	)
+	if !curr.isArray() {
+		options, tables = f.collapseTables(options, tables)
+	}
+	if !curr.isArray() && (f.withEmpty || len(options) > 0) {
 		f.formatHeader(curr, paths)
-		err := f.formatOptions(options, append(paths, curr.key.Literal))
+		parents := paths
+		if !curr.isRoot() {
+			parents = append(parents, f.formatKey(curr.key))
+		}
+		err := f.formatOptions(options, parents)
 		if err != nil {
 			return nil
 		}
 		f.endLine()
 	}
 	if !curr.isRoot() && curr.kind.isContainer() {
-		paths = append(paths, curr.key.Literal)
+		paths = append(paths, f.formatKey(curr.key))
 	}
 	if f.canNest(curr) {
 		f.enterLevel(false)
 		defer f.leaveLevel(false)
 	}
-	for _, next := range curr.listTables() {
+	for _, next := range tables {
 		if err := f.formatTable(next, paths); err != nil {
 			return err
 		}
@@ -264,16 +579,101 @@ func (f *Formatter) formatTable(curr *Table, paths []string) error {
 	return nil
 }
 
+// collapseTables gives the tables that can be written as inline tables (see
+// WithCollapse) as options to be written after the other options. The tables
+// that should still be written as tables are returned.
+func (f *Formatter) collapseTables(options []*Option, tables []*Table) ([]*Option, []*Table) {
+	if f.withCollapse <= 0 || f.withInline {
+		return options, tables
+	}
+	var rest []*Table
+	for _, t := range tables {
+		if !f.canCollapse(t) {
+			rest = append(rest, t)
+			continue
+		}
+		i := Table{
+			kind:  tableInline,
+			nodes: append([]Node{}, t.nodes...),
+		}
+		if f.collapsed == nil {
+			f.collapsed = make(map[*Table]struct{})
+		}
+		f.collapsed[&i] = struct{}{}
+		options = append(options, &Option{
+			comment: t.comment,
+			key:     t.key,
+			value:   &i,
+		})
+	}
+	if f.withSort {
+		sort.SliceStable(options, func(i, j int) bool {
+			return options[i].key.Literal < options[j].key.Literal
+		})
+	}
+	return options, rest
+}
+
+func (f *Formatter) canCollapse(t *Table) bool {
+	if t.kind != tableRegular || len(t.listTables()) > 0 {
+		return false
+	}
+	options := t.listOptions()
+	if len(options) == 0 || len(options) >= f.withCollapse {
+		return false
+	}
+	for _, o := range options {
+		if o.comment.pre != "" || o.comment.post != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// listOptions gives the options of t in the order they should be written.
+func (f *Formatter) listOptions(t *Table) []*Option {
+	vs := t.listOptions()
+	if f.withSort {
+		sort.SliceStable(vs, func(i, j int) bool {
+			return vs[i].key.Literal < vs[j].key.Literal
+		})
+	}
+	return vs
+}
+
+// listTables gives the sub tables of t in the order they should be written.
+// The items of an array of tables are never sorted.
+func (f *Formatter) listTables(t *Table) []*Table {
+	vs := t.listTables()
+	if f.withSort && !t.isArray() {
+		sort.SliceStable(vs, func(i, j int) bool {
+			return vs[i].key.Literal < vs[j].key.Literal
+		})
+	}
+	return vs
+}
+
 func (f *Formatter) formatOptions(options []*Option, paths []string) error {
 	type table struct {
 		prefix string
 		*Table
 	}
 	var (
-		length  = longestKey(options)
+		length  = f.longestKey(options)
 		array   int
 		inlines []table
 	)
+	if f.withAlign == alignInline {
+		if n := f.longestInlineKey(options); n > length {
+			length = n
+		}
+	}
+	if f.keyWidth > length {
+		length = f.keyWidth
+	}
+	if f.withAlign == alignNone {
+		length = 0
+	}
 	for _, o := range options {
 		if i, ok := o.value.(*Table); ok && f.withInline {
 			i.kind = tableRegular
@@ -311,7 +711,13 @@ func (f *Formatter) formatOptions(options []*Option, paths []string) error {
 		}
 		f.formatComment(o.comment.pre, true)
 		f.beginLine()
-		f.writeKey(o.key.Literal, length)
+		key := f.formatKey(o.key)
+		f.writeKey(key, length)
+		width := utf8.RuneCountInString(key)
+		if length > width {
+			width = length
+		}
+		f.column = f.indentWidth() + width + len(" = ")
 		if err := f.formatValue(o.value); err != nil {
 			return err
 		}
@@ -322,6 +728,12 @@ func (f *Formatter) formatOptions(options []*Option, paths []string) error {
 		f.endLine()
 		f.enterLevel(false)
 		defer f.leaveLevel(false)
+		if f.withAlign == alignInline {
+			defer func(width int) {
+				f.keyWidth = width
+			}(f.keyWidth)
+			f.keyWidth = length
+		}
 		for _, i := range inlines {
 			parents := append([]string{}, paths...)
 			if i.prefix != "" {
@@ -358,7 +770,7 @@ func (f *Formatter) formatValue(n Node) error {
 }
 
 func (f *Formatter) formatLiteral(i *Literal) error {
-	if i.token.isString() {
+	if i.token.IsString() {
 		f.formatString(i.token)
 		return nil
 	}
@@ -374,8 +786,9 @@ func (f *Formatter) formatString(tok Token) {
 		isMulti bool
 		quoting string
 		escape  func(rune) (rune, bool)
+		kind    = f.stringType(tok)
 	)
-	switch tok.Type {
+	switch kind {
 	case TokBasic:
 		escape = escapeBasic
 		quoting = "\""
@@ -389,27 +802,65 @@ func (f *Formatter) formatString(tok Token) {
 	default:
 		return
 	}
+	if isMulti && f.withMultiline && kind == tok.Type {
+		f.writer.WriteString(strings.ReplaceAll(tok.Raw, "\n", f.withEOL))
+		return
+	}
 	f.writer.WriteString(quoting)
 	if isMulti {
 		f.endLine()
 	}
 	str := escapeString(tok.Literal, isMulti, escape)
-	if isMulti && strings.IndexByte(str, newline) < 0 {
-		str = textWrap(str)
+	if isMulti && f.withWrap > 0 && strings.IndexByte(str, newline) < 0 {
+		str = textWrap(str, f.withWrap)
 	}
 	f.writer.WriteString(str)
 	f.writer.WriteString(quoting)
 }
 
-func textWrap(str string) string {
+// stringType gives the type of string to use to write tok according to the
+// string style of the formatter.
+func (f *Formatter) stringType(tok Token) rune {
+	switch {
+	case f.withString == stringBasic && tok.Type == TokLiteral:
+		return TokBasic
+	case f.withString == stringBasic && tok.Type == TokLiteralMulti:
+		return TokBasicMulti
+	case f.withString == stringLiteral && tok.Type == TokBasic && canLiteral(tok.Literal, false):
+		return TokLiteral
+	case f.withString == stringLiteral && tok.Type == TokBasicMulti && canLiteral(tok.Literal, true):
+		return TokLiteralMulti
+	default:
+		return tok.Type
+	}
+}
+
+// canLiteral reports whether str can be written as a literal string: literal
+// strings have no escape sequences so they can not contain control characters
+// (except tabs and, for multiline strings, newlines) nor their own delimiter.
+func canLiteral(str string, multi bool) bool {
+	if multi && (strings.Contains(str, "'''") || strings.HasSuffix(str, "'")) {
+		return false
+	}
+	for _, r := range str {
+		switch {
+		case r == squote && !multi:
+			return false
+		case r == newline && multi:
+		case r == tab:
+		case r < space || r == 0x7f || r == utf8.RuneError:
+			return false
+		}
+	}
+	return true
+}
+
+func textWrap(str string, length int) string {
 	var (
 		scan = bufio.NewScanner(strings.NewReader(str))
 		buf  strings.Builder
 	)
-	const (
-		length = 72
-		limit  = 8
-	)
+	const limit = 8
 	scan.Split(func(data []byte, ateof bool) (int, []byte, error) {
 		if ateof {
 			return len(data), data, bufio.ErrFinalToken
@@ -526,9 +977,21 @@ func (f *Formatter) formatArray(a *Array) error {
 	if len(a.nodes) <= 1 || f.withArray == arraySingle {
 		return f.formatArrayLine(a)
 	}
+	if f.withWidth > 0 {
+		if f.fitLine(a) {
+			return f.formatArrayLine(a)
+		}
+		return f.formatArrayMultiline(a)
+	}
 	if f.withArray == arrayMulti {
 		return f.formatArrayMultiline(a)
 	}
+	if f.withArray == arrayThreshold {
+		if len(a.nodes) > f.withThreshold {
+			return f.formatArrayMultiline(a)
+		}
+		return f.formatArrayLine(a)
+	}
 	if a.isMultiline() {
 		return f.formatArrayMultiline(a)
 	}
@@ -557,20 +1020,42 @@ func (f *Formatter) formatArrayMultiline(a *Array) error {
 
 	f.writer.WriteString("[")
 	f.endLine()
-	for _, n := range a.nodes {
+	for i, n := range a.nodes {
 		com := retr(n)
 		f.formatComment(com.pre, true)
 		f.beginLine()
+		f.column = f.indentWidth()
 		if err := f.formatValue(n); err != nil {
 			return err
 		}
-		f.writer.WriteString(",")
+		if i < len(a.nodes)-1 || f.withComma {
+			f.writer.WriteString(",")
+		}
 		f.formatComment(com.post, false)
 		f.endLine()
 	}
 	return nil
 }
 
+// fitLine reports whether a written on a single line from the current column
+// fits in the width given by WithWidth.
+func (f *Formatter) fitLine(a *Array) bool {
+	var (
+		buf    bytes.Buffer
+		writer = f.writer
+		array  = f.withArray
+	)
+	f.writer, f.withArray = bufio.NewWriter(&buf), arraySingle
+	err := f.formatArrayLine(a)
+	f.writer.Flush()
+	f.writer, f.withArray = writer, array
+
+	if err != nil || bytes.ContainsAny(buf.Bytes(), "\r\n") {
+		return false
+	}
+	return f.column+utf8.RuneCount(buf.Bytes()) <= f.withWidth
+}
+
 func (f *Formatter) formatArrayLine(a *Array) error {
 	f.writer.WriteString("[")
 	for i, n := range a.nodes {
@@ -589,13 +1074,17 @@ func (f *Formatter) formatInline(t *Table) error {
 	defer func(array int) {
 		f.withArray = array
 	}(f.withArray)
-	f.withArray = arraySingle
+	// arrays of the tables written as inline tables by WithCollapse are written
+	// like the other arrays
+	if _, ok := f.collapsed[t]; !ok {
+		f.withArray = arraySingle
+	}
 	f.writer.WriteString("{")
-	for i, o := range t.listOptions() {
+	for i, o := range f.listOptions(t) {
 		if i > 0 {
 			f.writer.WriteString(", ")
 		}
-		f.writeKey(o.key.Literal, 0)
+		f.writeKey(f.formatKey(o.key), 0)
 		if err := f.formatValue(o.value); err != nil {
 			return err
 		}
@@ -609,7 +1098,7 @@ func (f *Formatter) formatHeader(curr *Table, paths []string) error {
 		return nil
 	}
 	if curr.kind != tableItem {
-		paths = append(paths, curr.key.Literal)
+		paths = append(paths, f.formatKey(curr.key))
 	}
 	f.formatComment(curr.comment.pre, true)
 	switch str := strings.Join(paths, "."); curr.kind {
@@ -667,8 +1156,8 @@ func (f *Formatter) canNest(curr *Table) bool {
 }
 
 func (f *Formatter) writeKey(str string, length int) {
-	n, _ := f.writer.WriteString(str)
-	if length > 0 {
+	f.writer.WriteString(str)
+	if n := utf8.RuneCountInString(str); length > n {
 		f.writer.WriteString(strings.Repeat(" ", length-n))
 	}
 	f.writer.WriteString(" = ")
@@ -705,6 +1194,12 @@ func (f *Formatter) endLine() {
 	f.writer.WriteString(f.withEOL)
 }
 
+// indentWidth gives the number of characters written by beginLine. A tab counts
+// for one column.
+func (f *Formatter) indentWidth() int {
+	return f.currLevel * utf8.RuneCountInString(f.withTab)
+}
+
 func (f *Formatter) beginLine() {
 	if f.currLevel == 0 {
 		return
@@ -712,10 +1207,34 @@ func (f *Formatter) beginLine() {
 	f.writer.WriteString(strings.Repeat(f.withTab, f.currLevel))
 }
 
-func longestKey(options []*Option) int {
+func (f *Formatter) formatKey(tok Token) string {
+	quote := tok.Type == TokBasic || tok.Type == TokLiteral
+	switch f.withQuote {
+	case keyMinimal:
+		quote = !isBareKey(tok.Literal)
+	case keyAll:
+		quote = true
+	default:
+		if tok.Type == TokLiteral {
+			return "'" + tok.Literal + "'"
+		}
+	}
+	if !quote {
+		return tok.Literal
+	}
+	return "\"" + escapeString(tok.Literal, false, escapeBasic) + "\""
+}
+
+// longestKey gives the number of characters of the longest key of the options
+// that are written as options (and not as tables when inline tables are
+// reformatted).
+func (f *Formatter) longestKey(options []*Option) int {
 	var length int
 	for _, o := range options {
-		n := len(o.key.Literal)
+		if f.isExpanded(o) {
+			continue
+		}
+		n := utf8.RuneCountInString(f.formatKey(o.key))
 		if length == 0 || length < n {
 			length = n
 		}
@@ -723,6 +1242,77 @@ func longestKey(options []*Option) int {
 	return length
 }
 
+// longestDocumentKey gives the number of characters of the longest key of the
+// options of t and of all its sub tables.
+func (f *Formatter) longestDocumentKey(t *Table) int {
+	var (
+		options = t.listOptions()
+		length  = f.longestKey(options)
+	)
+	if n := f.longestInlineKey(options); n > length {
+		length = n
+	}
+	for _, next := range t.listTables() {
+		if n := f.longestDocumentKey(next); n > length {
+			length = n
+		}
+	}
+	return length
+}
+
+// longestInlineKey gives the number of characters of the longest key of the
+// tables created from the inline tables of options.
+func (f *Formatter) longestInlineKey(options []*Option) int {
+	var length int
+	for _, o := range options {
+		if !f.withInline {
+			break
+		}
+		var tables []*Table
+		switch v := o.value.(type) {
+		case *Table:
+			tables = append(tables, v)
+		case *Array:
+			for _, n := range v.nodes {
+				if t, ok := n.(*Table); ok {
+					tables = append(tables, t)
+				}
+			}
+		}
+		for _, t := range tables {
+			opts := t.listOptions()
+			if n := f.longestKey(opts); n > length {
+				length = n
+			}
+			if n := f.longestInlineKey(opts); n > length {
+				length = n
+			}
+		}
+	}
+	return length
+}
+
+// isExpanded reports whether o is written as a (array of) table(s) instead of
+// an option.
+func (f *Formatter) isExpanded(o *Option) bool {
+	if !f.withInline {
+		return false
+	}
+	switch v := o.value.(type) {
+	case *Table:
+		return true
+	case *Array:
+		for _, n := range v.nodes {
+			if _, ok := n.(*Table); !ok {
+				return false
+			}
+		}
+		return len(v.nodes) > 0
+	default:
+		return false
+	}
+}
+
 func formatString(str string) string {
 	return str
 }
@@ -752,14 +1342,18 @@ func formatTime(pattern string, utc bool) func(string) (string, error) {
 	}
 }
 
-func formatFloat(specifier byte, underscore int) func(string) (string, error) {
+func formatFloat(specifier byte, integer, fraction int) func(string) (string, error) {
 	return func(str string) (string, error) {
-		f, err := strconv.ParseFloat(str, 64)
+		f, err := parseFloat(str)
 		if err != nil {
 			return "", err
 		}
+		if isNonFinite(f) {
+			// inf and nan are kept as written: FormatFloat gives +Inf and NaN
+			return str, nil
+		}
 		str = strconv.FormatFloat(f, specifier, -1, 64)
-		return withUnderscore(str, underscore), nil
+		return withGroups(str, integer, fraction), nil
 	}
 }
 
@@ -775,30 +1369,44 @@ func formatInteger(base, underscore int, prefix string) func(string) (string, er
 }
 
 func withUnderscore(str string, every int) string {
-	if every == 0 || len(str) < every {
-		return str
+	return withGroups(str, every, every)
+}
+
+// withGroups inserts an underscore every integer digits in the integer part
+// and in the exponent of str and every fraction digits in its fractional part.
+func withGroups(str string, integer, fraction int) string {
+	var sign string
+	if strings.HasPrefix(str, "-") || strings.HasPrefix(str, "+") {
+		sign, str = str[:1], str[1:]
 	}
 	x := strings.Index(str, ".")
 	if x < 0 {
-		return insertUnderscore(str, every)
+		x = strings.IndexAny(str, "eE")
+		if x < 0 {
+			return sign + insertUnderscore(str, integer)
+		}
+		return sign + insertUnderscore(str[:x], integer) + withExponent(str[x+1:], integer)
 	}
-	part := insertUnderscore(str[:x], every) + "."
+	part := sign + insertUnderscore(str[:x], integer) + "."
 	str = str[x+1:]
 	x = strings.IndexAny(str, "eE")
 	if x < 0 {
-		return part + insertUnderscore(str, every)
+		return part + insertUnderscoreLeft(str, fraction)
 	}
-	part += insertUnderscore(str[:x], every)
-	part += "e"
-	if str[x+1] == '+' || str[x+1] == '-' {
-		x++
-		part += string(str[x])
+	part += insertUnderscoreLeft(str[:x], fraction)
+	return part + withExponent(str[x+1:], integer)
+}
+
+func withExponent(str string, every int) string {
+	part := "e"
+	if str != "" && (str[0] == '+' || str[0] == '-') {
+		part, str = part+str[:1], str[1:]
 	}
-	return part + insertUnderscore(str[x+1:], every)
+	return part + insertUnderscore(str, every)
 }
 
 func insertUnderscore(str string, every int) string {
-	if len(str) <= every {
+	if every <= 0 || len(str) <= every {
 		return str
 	}
 	var (
@@ -817,3 +1425,23 @@ func insertUnderscore(str string, every int) string {
 	buf.WriteString(str[i:])
 	return buf.String()
 }
+
+// insertUnderscoreLeft is like insertUnderscore but groups the digits of str
+// from the left as it is expected for the fractional part of a float.
+func insertUnderscoreLeft(str string, every int) string {
+	if every <= 0 || len(str) <= every {
+		return str
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(str); i += every {
+		if i > 0 {
+			buf.WriteString("_")
+		}
+		j := i + every
+		if j > len(str) {
+			j = len(str)
+		}
+		buf.WriteString(str[i:j])
+	}
+	return buf.String()
+}
@@ -0,0 +1,620 @@
+package toml
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func formatDocument(t *testing.T, doc string, rules ...FormatRule) string {
+	t.Helper()
+	w, err := ioutil.TempFile("", "format-*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(w.Name())
+	w.WriteString(doc)
+	w.Close()
+
+	f, err := NewFormatter(w.Name(), rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Format(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTextWrap(t *testing.T) {
+	const str = "The quick brown fox jumps over the lazy dog. The quick brown fox jumps over the lazy dog. The quick brown fox jumps over the lazy dog."
+	for _, width := range []int{20, 40, 72, 100} {
+		got := textWrap(str, width)
+		lines := strings.Split(got, "\\\n")
+		for i, line := range lines {
+			if i < len(lines)-1 && len(line) < width {
+				t.Errorf("%d: line %d too short (%d): %q", width, i, len(line), line)
+			}
+			if len(line) >= width+8+len("jumps ") {
+				t.Errorf("%d: line %d too long (%d): %q", width, i, len(line), line)
+			}
+		}
+		if joined := strings.Join(lines, ""); joined != str {
+			t.Errorf("%d: text altered by wrapping: %q", width, joined)
+		}
+	}
+}
+
+func TestFormatPreserveMultiline(t *testing.T) {
+	const doc = `query = """
+SELECT *
+  FROM users \
+  WHERE id = 1"""
+`
+	got := formatDocument(t, doc, WithPreserveMultiline(true))
+	if strings.TrimSpace(got) != strings.TrimSpace(doc) {
+		t.Errorf("multiline string altered:\nwant: %q\ngot:  %q", doc, got)
+	}
+}
+
+func TestFormatHeaderComment(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  string
+	}{
+		{
+			Input: "# header\n# license\n\n# name of package\nname = \"toml\"\n",
+			Want:  "# header\n# license\n\n# name of package\nname = \"toml\"",
+		},
+		{
+			Input: "# header\n\n[dev]\nname = \"midbel\"\n",
+			Want:  "# header\n\n[dev]\nname = \"midbel\"",
+		},
+		{
+			Input: "# name of package\nname = \"toml\"\n",
+			Want:  "# name of package\nname = \"toml\"",
+		},
+	}
+	for _, d := range data {
+		got := formatDocument(t, d.Input)
+		if got = strings.TrimSpace(got); got != d.Want {
+			t.Errorf("header comment not preserved: want %q, got %q", d.Want, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	const doc = `
+name  = "toml"
+tags  = ["config", "parser"]
+owner = {name = "midbel"}
+
+[dev]
+site = "https://github.com/midbel"
+`
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := n.(*Table)
+	options := root.listOptions()
+	data := []struct {
+		Node
+		Want string
+	}{
+		{Node: options[0], Want: `name = "toml"`},
+		{Node: options[1].value, Want: `["config", "parser"]`},
+		{Node: options[2].value, Want: `{name = "midbel"}`},
+		{Node: root.listTables()[0], Want: "[dev]\nsite = \"https://github.com/midbel\""},
+	}
+	for _, d := range data {
+		got := strings.TrimSpace(String(d.Node))
+		if got != d.Want {
+			t.Errorf("node not written properly: want %q, got %q", d.Want, got)
+		}
+	}
+	if got := String(root); !strings.Contains(got, "[dev]") || !strings.HasPrefix(got, "name") {
+		t.Errorf("document not written properly: %q", got)
+	}
+}
+
+func TestFormatKeyQuoting(t *testing.T) {
+	const doc = `
+"name"   = "toml"
+'site'   = "github"
+"a b"    = 1
+version  = "1.0.0"
+
+["dev"]
+"e-mail" = "noreply@midbel.org"
+`
+	data := []struct {
+		Quoting string
+		Want    string
+	}{
+		{
+			Quoting: "preserve",
+			Want:    "\"name\"  = \"toml\"\n'site'  = \"github\"\n\"a b\"   = 1\nversion = \"1.0.0\"\n\n[\"dev\"]\n\"e-mail\" = \"noreply@midbel.org\"",
+		},
+		{
+			Quoting: "minimal",
+			Want:    "name    = \"toml\"\nsite    = \"github\"\n\"a b\"   = 1\nversion = \"1.0.0\"\n\n[dev]\ne-mail = \"noreply@midbel.org\"",
+		},
+		{
+			Quoting: "all",
+			Want:    "\"name\"    = \"toml\"\n\"site\"    = \"github\"\n\"a b\"     = 1\n\"version\" = \"1.0.0\"\n\n[\"dev\"]\n\"e-mail\" = \"noreply@midbel.org\"",
+		},
+	}
+	for _, d := range data {
+		got := strings.TrimSpace(formatDocument(t, doc, WithKeyQuoting(d.Quoting)))
+		if got != d.Want {
+			t.Errorf("%s: keys not quoted properly:\nwant: %q\ngot:  %q", d.Quoting, d.Want, got)
+		}
+	}
+}
+
+func TestFormatFloatGroups(t *testing.T) {
+	data := []struct {
+		Input    string
+		Integer  int
+		Fraction int
+		Want     string
+	}{
+		{Input: "3.14159265", Integer: 3, Fraction: 3, Want: "3.141_592_65"},
+		{Input: "1234567.891", Integer: 3, Fraction: 3, Want: "1_234_567.891"},
+		{Input: "1234567.891", Integer: 3, Fraction: 0, Want: "1_234_567.891"},
+		{Input: "1234567.891234", Integer: 0, Fraction: 2, Want: "1234567.89_12_34"},
+		{Input: "-123456.5", Integer: 3, Fraction: 3, Want: "-123_456.5"},
+		{Input: "-inf", Integer: 3, Fraction: 3, Want: "-inf"},
+		{Input: "+nan", Integer: 3, Fraction: 3, Want: "+nan"},
+	}
+	for _, d := range data {
+		got, err := formatFloat('f', d.Integer, d.Fraction)(d.Input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", d.Input, err)
+			continue
+		}
+		if got != d.Want {
+			t.Errorf("%s: want %s, got %s", d.Input, d.Want, got)
+		}
+	}
+	got := formatDocument(t, "pi = 3.14159265\n", WithFloat("f", 3))
+	if want := "pi = 3.141_592_65"; strings.TrimSpace(got) != want {
+		t.Errorf("float not formatted properly: want %q, got %q", want, got)
+	}
+}
+
+func TestWithUnderscore(t *testing.T) {
+	data := []struct {
+		Input string
+		Every int
+		Want  string
+	}{
+		{Input: "0.123456", Every: 3, Want: "0.123_456"},
+		{Input: "0.1234567", Every: 3, Want: "0.123_456_7"},
+		{Input: "0.12345", Every: 2, Want: "0.12_34_5"},
+		{Input: "12345.12345", Every: 2, Want: "1_23_45.12_34_5"},
+		{Input: "1.234567e+10", Every: 3, Want: "1.234_567e+10"},
+		{Input: "1.234567e-1234", Every: 2, Want: "1.23_45_67e-12_34"},
+		{Input: "12345e10", Every: 3, Want: "12_345e10"},
+		{Input: "123456", Every: 3, Want: "123_456"},
+		{Input: "-1234", Every: 3, Want: "-1_234"},
+		{Input: "0.5", Every: 3, Want: "0.5"},
+	}
+	for _, d := range data {
+		if got := withUnderscore(d.Input, d.Every); got != d.Want {
+			t.Errorf("%s: want %s, got %s", d.Input, d.Want, got)
+		}
+	}
+}
+
+func TestFormatWindowsPaths(t *testing.T) {
+	const doc = `path  = 'C:\Users\midbel'
+share = '\\server\share\toml'
+`
+	var c struct {
+		Path  string
+		Share string
+	}
+	if err := Decode(strings.NewReader(doc), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want := `C:\Users\midbel`; c.Path != want {
+		t.Errorf("path: want %s, got %s", want, c.Path)
+	}
+	if want := `\\server\share\toml`; c.Share != want {
+		t.Errorf("share: want %s, got %s", want, c.Share)
+	}
+	if got := formatDocument(t, doc); strings.TrimSpace(got) != strings.TrimSpace(doc) {
+		t.Errorf("literal strings not preserved:\nwant: %s\ngot:  %s", doc, got)
+	}
+}
+
+func TestFormatFinalNewline(t *testing.T) {
+	const doc = "name = \"toml\"\n\n[[dev]]\nname = \"midbel\"\n\n\n"
+
+	got := formatDocument(t, doc)
+	if want := "name = \"toml\"\n\n[[dev]]\nname = \"midbel\"\n"; got != want {
+		t.Errorf("final newline: want %q, got %q", want, got)
+	}
+	got = formatDocument(t, doc, WithFinalNewline(false))
+	if want := "name = \"toml\"\n\n[[dev]]\nname = \"midbel\""; got != want {
+		t.Errorf("no final newline: want %q, got %q", want, got)
+	}
+	got = formatDocument(t, doc, WithEmpty(true), WithEOL("crlf"))
+	if want := "name = \"toml\"\r\n\r\n[[dev]]\r\nname = \"midbel\"\r\n"; got != want {
+		t.Errorf("empty tables: want %q, got %q", want, got)
+	}
+	if got := formatDocument(t, ""); got != "" {
+		t.Errorf("empty document: want no output, got %q", got)
+	}
+}
+
+func TestNewFormatterNode(t *testing.T) {
+	const doc = "name = \"toml\"\n\n[dev]\nname = \"midbel\"\n"
+
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFormatterNode(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := f.Format(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := formatDocument(t, doc); buf.String() != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, buf.String())
+	}
+	f, err = NewFormatterReader(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := f.Format(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := formatDocument(t, doc); buf.String() != want {
+		t.Errorf("document mismatched:\nwant: %q\ngot:  %q", want, buf.String())
+	}
+	if _, err := NewFormatterNode(&Literal{}); err == nil {
+		t.Errorf("formatter should only accept table")
+	}
+}
+
+func TestFormatArrayThreshold(t *testing.T) {
+	const doc = `
+short = [
+	1,
+	2,
+]
+long = [1, 2, 3, 4]
+`
+	const want = "short = [1, 2]\nlong  = [\n\t1,\n\t2,\n\t3,\n\t4,\n]"
+	got := strings.TrimSpace(formatDocument(t, doc, WithArrayThreshold(3)))
+	if got != want {
+		t.Errorf("arrays not formatted properly:\nwant: %q\ngot:  %q", want, got)
+	}
+	if _, err := newFormatter(nil, WithArrayThreshold(-1)); err == nil {
+		t.Errorf("negative threshold should be rejected")
+	}
+}
+
+func TestFormatTrailingComma(t *testing.T) {
+	const doc = `
+long  = [1, 2, 3, 4]
+short = [1, 2]
+`
+	const want = "long  = [\n\t1,\n\t2,\n\t3,\n\t4\n]\nshort = [1, 2]"
+	got := strings.TrimSpace(formatDocument(t, doc, WithArrayThreshold(3), WithTrailingComma(false)))
+	if got != want {
+		t.Errorf("arrays not formatted properly:\nwant: %q\ngot:  %q", want, got)
+	}
+	got = strings.TrimSpace(formatDocument(t, doc, WithArrayThreshold(3)))
+	if !strings.Contains(got, "\t4,\n]") {
+		t.Errorf("trailing comma missing:\n%s", got)
+	}
+}
+
+func TestFormatWidth(t *testing.T) {
+	const doc = `
+short = [1, 2, 3]
+long  = ["alpha", "beta", "gamma", [1, 2], {name = "delta"}]
+`
+	const want = `short = [1, 2, 3]
+long  = [
+	"alpha",
+	"beta",
+	"gamma",
+	[1, 2],
+	{name = "delta"},
+]`
+	got := strings.TrimSpace(formatDocument(t, doc, WithWidth(30)))
+	if got != want {
+		t.Errorf("arrays not wrapped properly:\nwant: %q\ngot:  %q", want, got)
+	}
+	// "long  = " and the array are 8 and 52 characters long
+	got = strings.TrimSpace(formatDocument(t, doc, WithWidth(60)))
+	if want := strings.TrimSpace(doc); got != want {
+		t.Errorf("arrays not kept on single line:\nwant: %q\ngot:  %q", want, got)
+	}
+	got = strings.TrimSpace(formatDocument(t, doc, WithWidth(59)))
+	if !strings.Contains(got, "long  = [\n") {
+		t.Errorf("array longer than width not wrapped:\n%s", got)
+	}
+	if _, err := newFormatter(nil, WithWidth(-1)); err == nil {
+		t.Errorf("negative width should be rejected")
+	}
+	combined := [][]FormatRule{
+		{WithWidth(80), WithArray("multi")},
+		{WithArray("single"), WithWidth(80)},
+		{WithWidth(80), WithArrayThreshold(2)},
+	}
+	for _, rules := range combined {
+		if _, err := newFormatter(nil, rules...); err == nil {
+			t.Errorf("width combined with array layout should be rejected")
+		}
+	}
+	if _, err := newFormatter(nil, WithArray("mixed"), WithWidth(80)); err != nil {
+		t.Errorf("width with mixed arrays should be accepted: %s", err)
+	}
+}
+
+func TestFormatAlignInline(t *testing.T) {
+	const doc = `
+name = "toml"
+dev = {name = "midbel", email = "noreply@midbel.org"}
+tags = [{label = "go"}, {label = "config"}]
+`
+	const want = `name = "toml"
+
+[dev]
+name  = "midbel"
+email = "noreply@midbel.org"
+
+[[tags]]
+label = "go"
+
+[[tags]]
+label = "config"`
+	got := strings.TrimSpace(formatDocument(t, doc, WithInline(true)))
+	if got != want {
+		t.Errorf("keys not aligned properly:\nwant: %q\ngot:  %q", want, got)
+	}
+
+	const aligned = `name  = "toml"
+
+[dev]
+name  = "midbel"
+email = "noreply@midbel.org"
+
+[[tags]]
+label = "go"
+
+[[tags]]
+label = "config"`
+	got = strings.TrimSpace(formatDocument(t, doc, WithInline(true), WithAlign("inline")))
+	if got != aligned {
+		t.Errorf("keys not aligned properly:\nwant: %q\ngot:  %q", aligned, got)
+	}
+}
+
+func TestFormatDetectEOL(t *testing.T) {
+	const doc = "# package\r\nname = \"toml\"\r\n\r\n[dev]\r\nname = \"midbel\"\r\n"
+
+	got := formatDocument(t, doc)
+	if want := doc; got != want {
+		t.Errorf("end of lines not preserved:\nwant: %q\ngot:  %q", want, got)
+	}
+	got = formatDocument(t, doc, WithEOL("lf"))
+	if want := strings.ReplaceAll(doc, "\r\n", "\n"); got != want {
+		t.Errorf("end of lines not converted:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestFormatStringStyle(t *testing.T) {
+	const doc = `
+single = 'single'
+double = "double"
+quote  = "it's"
+escape = "line\nbreak"
+path   = "C:\\path"
+multi  = """
+basic "multi"
+line"""
+`
+	data := []struct {
+		Style string
+		Want  []string
+	}{
+		{
+			Style: "basic",
+			Want:  []string{`single = "single"`, `path   = "C:\\path"`, `multi  = """`},
+		},
+		{
+			Style: "literal",
+			Want:  []string{`double = 'double'`, `quote  = "it's"`, `escape = "line\nbreak"`, `path   = 'C:\path'`, `multi  = '''`},
+		},
+	}
+	var want map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&want); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		str := formatDocument(t, doc, WithStringStyle(d.Style))
+		for _, w := range d.Want {
+			if !strings.Contains(str, w) {
+				t.Errorf("%s: %s not found in\n%s", d.Style, w, str)
+			}
+		}
+		var got map[string]interface{}
+		if err := NewDecoder(strings.NewReader(str)).Decode(&got); err != nil {
+			t.Errorf("%s: invalid document written: %s", d.Style, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: values mismatched:\nwant: %v\ngot:  %v", d.Style, want, got)
+		}
+	}
+	if _, err := newFormatter(nil, WithStringStyle("backtick")); err == nil {
+		t.Errorf("unknown string style should be rejected")
+	}
+}
+
+func TestFormatAlign(t *testing.T) {
+	const doc = `
+name = "toml"
+version = "1.0.0"
+
+[dev]
+name = "midbel"
+mail = "noreply@midbel.org"
+
+[[dependencies]]
+repository = "github.com/midbel/glob"
+`
+	data := []struct {
+		Mode string
+		Want string
+	}{
+		{
+			Mode: "table",
+			Want: "name    = \"toml\"\nversion = \"1.0.0\"\n\n[dev]\nname = \"midbel\"\nmail = \"noreply@midbel.org\"\n\n[[dependencies]]\nrepository = \"github.com/midbel/glob\"",
+		},
+		{
+			Mode: "none",
+			Want: "name = \"toml\"\nversion = \"1.0.0\"\n\n[dev]\nname = \"midbel\"\nmail = \"noreply@midbel.org\"\n\n[[dependencies]]\nrepository = \"github.com/midbel/glob\"",
+		},
+		{
+			Mode: "document",
+			Want: "name       = \"toml\"\nversion    = \"1.0.0\"\n\n[dev]\nname       = \"midbel\"\nmail       = \"noreply@midbel.org\"\n\n[[dependencies]]\nrepository = \"github.com/midbel/glob\"",
+		},
+	}
+	for _, d := range data {
+		got := strings.TrimSpace(formatDocument(t, doc, WithAlign(d.Mode)))
+		if got != d.Want {
+			t.Errorf("%s: keys not aligned properly:\nwant: %q\ngot:  %q", d.Mode, d.Want, got)
+		}
+	}
+	if _, err := newFormatter(nil, WithAlign("right")); err == nil {
+		t.Errorf("unknown alignment should be rejected")
+	}
+}
+
+func TestFormatCollapse(t *testing.T) {
+	const doc = `
+name = "toml"
+
+[owner]
+name = "midbel"
+site = "midbel.org"
+
+[dev]
+name = "midbel"
+tags = ["go", "toml"]
+
+[server]
+host = "localhost"
+port = 8080
+mode = "prod"
+
+[[plugins]]
+name = "lint"
+
+[plugins.options]
+strict = true
+`
+	const want = `name  = "toml"
+owner = {name = "midbel", site = "midbel.org"}
+dev   = {name = "midbel", tags = [
+	"go",
+	"toml",
+]}
+
+[server]
+host = "localhost"
+port = 8080
+mode = "prod"
+
+[[plugins]]
+name    = "lint"
+options = {strict = true}`
+	str := formatDocument(t, doc, WithCollapse(3), WithArray("multi"))
+	if got := strings.TrimSpace(str); got != want {
+		t.Errorf("tables not collapsed properly:\nwant: %q\ngot:  %q", want, got)
+	}
+	var v1, v2 map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDecoder(strings.NewReader(str)).Decode(&v2); err != nil {
+		t.Fatalf("invalid document written: %s", err)
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		t.Errorf("values mismatched:\nwant: %v\ngot:  %v", v1, v2)
+	}
+}
+
+func TestFormatSortKeys(t *testing.T) {
+	const doc = `
+version = "1.0.0"
+name    = "toml"
+owner   = {site = "midbel.org", name = "midbel"}
+
+[[plugins]]
+name = "lint"
+enabled = true
+
+[[plugins]]
+name = "fmt"
+enabled = false
+
+[dev]
+name = "midbel"
+email = "noreply@midbel.org"
+`
+	const want = `name    = "toml"
+owner   = {name = "midbel", site = "midbel.org"}
+version = "1.0.0"
+
+[dev]
+email = "noreply@midbel.org"
+name  = "midbel"
+
+[[plugins]]
+enabled = true
+name    = "lint"
+
+[[plugins]]
+enabled = false
+name    = "fmt"`
+	got := strings.TrimSpace(formatDocument(t, doc, WithSortKeys(true)))
+	if got != want {
+		t.Errorf("keys not sorted properly:\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestFormatAlignMultibyteKeys(t *testing.T) {
+	const doc = `
+"clé" = 1
+"année" = 2019
+nom = "toml"
+version = "1.0.0"
+`
+	got := strings.TrimSpace(formatDocument(t, doc))
+	var column int
+	for i, line := range strings.Split(got, "\n") {
+		n := utf8.RuneCountInString(line[:strings.Index(line, "=")])
+		if i > 0 && n != column {
+			t.Errorf("keys not aligned: %q (column %d, want %d)", line, n, column)
+		}
+		column = n
+	}
+}
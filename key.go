@@ -0,0 +1,61 @@
+package toml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SameKey reports whether the keys a and b, written as they would be in a
+// TOML document, designate the same key. Quotes around a segment that could be
+// written bare are not significant ("a" and a are the same key) but dots inside
+// quotes are part of the segment ("a.b" and a.b are different keys). Invalid
+// keys are never the same.
+//
+// The parser does not use it: the keys of a document are split and unquoted
+// by the scanner, so the parser compares their segments as they are.
+func SameKey(a, b string) bool {
+	as, err := splitKey(a)
+	if err != nil {
+		return false
+	}
+	bs, err := splitKey(b)
+	if err != nil || len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// splitKey gives the segments of the (dotted) key str without their quotes.
+// The key is read by the Scanner so that its quoted segments are unescaped as
+// they would be in a document.
+func splitKey(str string) ([]string, error) {
+	s, err := NewScanner(strings.NewReader(str))
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	var parts []string
+	for {
+		tok := s.Scan()
+		switch {
+		case tok.Type == TokEOF:
+			return nil, fmt.Errorf("%s: missing key", str)
+		case !tok.IsKey():
+			return nil, fmt.Errorf("%s: invalid key %s", str, tok)
+		}
+		parts = append(parts, tok.Literal)
+		switch tok = s.Scan(); tok.Type {
+		case TokEOF:
+			return parts, nil
+		case TokDot:
+		default:
+			return nil, fmt.Errorf("%s: expected '.', got %s", str, tok)
+		}
+	}
+}
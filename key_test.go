@@ -0,0 +1,50 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSameKey(t *testing.T) {
+	data := []struct {
+		A, B string
+		Want bool
+	}{
+		{A: "a", B: "a", Want: true},
+		{A: `"a"`, B: "a", Want: true},
+		{A: "'a'", B: `"a"`, Want: true},
+		{A: `"a.b"`, B: "a.b", Want: false},
+		{A: "a . b", B: `a."b"`, Want: true},
+		{A: `"a b".c`, B: `'a b'.c`, Want: true},
+		{A: "a.b", B: "a.b.c", Want: false},
+		{A: "a", B: "A", Want: false},
+		{A: "", B: "", Want: false},
+		{A: "a..b", B: "a..b", Want: false},
+		{A: `"a`, B: `"a`, Want: false},
+		{A: `"\u00e9t\u00E9"`, B: "'été'", Want: true},
+		{A: `"\U0001F600"`, B: "'\U0001F600'", Want: true},
+		{A: `"\x41"`, B: "A", Want: false},
+		{A: `"a\tb"`, B: "'a\tb'", Want: true},
+	}
+	for _, d := range data {
+		if got := SameKey(d.A, d.B); got != d.Want {
+			t.Errorf("%s == %s: want %t, got %t", d.A, d.B, d.Want, got)
+		}
+	}
+}
+
+func TestDecodeSectionQuotedPath(t *testing.T) {
+	const sample = `
+["server.eu"]
+host = "eu.example.org"
+`
+	c := struct {
+		Host string
+	}{}
+	if err := DecodeSection(strings.NewReader(sample), `"server.eu"`, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Host != "eu.example.org" {
+		t.Errorf("host: want %s, got %s", "eu.example.org", c.Host)
+	}
+}
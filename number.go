@@ -0,0 +1,68 @@
+package toml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Number represents an integer or a float exactly as it has been written in
+// a TOML document (sign, base prefix and underscores included).
+type Number string
+
+// IsInt reports whether the number is an integer.
+func (n Number) IsInt() bool {
+	return !n.IsFloat()
+}
+
+// IsFloat reports whether the number is a float, special values inf and nan
+// included.
+func (n Number) IsFloat() bool {
+	if n.Base() != 10 {
+		return false
+	}
+	str := strings.TrimLeft(string(n), "+-")
+	if str == "inf" || str == "nan" {
+		return true
+	}
+	return strings.ContainsAny(str, ".eE")
+}
+
+// Base gives the base used to write the number: 2, 8, 16 or 10.
+func (n Number) Base() int {
+	str := string(n)
+	if len(str) < 2 || str[0] != zero {
+		return 10
+	}
+	switch str[1] {
+	case hex:
+		return 16
+	case oct:
+		return 8
+	case bin:
+		return 2
+	default:
+		return 10
+	}
+}
+
+// Int64 returns the number as an int64.
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(n.clean(), 0, 64)
+}
+
+// Float64 returns the number as a float64.
+func (n Number) Float64() (float64, error) {
+	if n.IsInt() {
+		i, err := n.Int64()
+		return float64(i), err
+	}
+	return parseFloat(n.clean())
+}
+
+func (n Number) String() string {
+	return string(n)
+}
+
+func (n Number) clean() string {
+	return strings.ReplaceAll(string(n), "_", "")
+}
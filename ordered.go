@@ -0,0 +1,148 @@
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// OrderedMap is a map that keeps its keys in the order they have been set.
+// When decoded, keys are in the order they appear in the document and the
+// sub tables are also decoded into *OrderedMap. When encoded, keys are written
+// in the same order.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// Create a new and empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{
+		values: make(map[string]interface{}),
+	}
+}
+
+// Set the value of key. A new key is added after the existing ones while an
+// existing key keeps its place.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = make(map[string]interface{})
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Get the value of key.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Delete removes key and its value from the map.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys gives the keys of the map in order.
+func (m *OrderedMap) Keys() []string {
+	ks := make([]string, len(m.keys))
+	copy(ks, m.keys)
+	return ks
+}
+
+// Len gives the number of keys in the map.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+var orderedMapType = reflect.TypeOf(OrderedMap{})
+
+func (d *Decoder) decodeOrdered(t *Table) (*OrderedMap, error) {
+	var (
+		m     = NewOrderedMap()
+		nodes = make([]Node, len(t.nodes))
+	)
+	copy(nodes, t.nodes)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Pos().Less(nodes[j].Pos())
+	})
+	for _, n := range nodes {
+		var (
+			key string
+			val interface{}
+			err error
+		)
+		switch n := n.(type) {
+		case *Option:
+			key = n.key.Literal
+			d.markUsed(key, n.Pos())
+			d.enter(key)
+			val, err = d.decodeOrderedValue(n.value)
+			d.leave()
+		case *Table:
+			key = n.key.Literal
+			d.markUsed(key, n.Pos())
+			d.enter(key)
+			if n.isArray() {
+				vs := make([]interface{}, 0, len(n.nodes))
+				for _, n := range n.nodes {
+					x, ok := n.(*Table)
+					if !ok {
+						err = fmt.Errorf("array: unexpected node type %T", n)
+						break
+					}
+					var v *OrderedMap
+					if v, err = d.decodeOrdered(x); err != nil {
+						break
+					}
+					vs = append(vs, v)
+				}
+				val = vs
+			} else {
+				val, err = d.decodeOrdered(n)
+			}
+			d.leave()
+		default:
+			err = fmt.Errorf("table: unexpected node type %T", n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, val)
+	}
+	return m, nil
+}
+
+func (d *Decoder) decodeOrderedValue(n Node) (interface{}, error) {
+	switch n := n.(type) {
+	case *Table:
+		return d.decodeOrdered(n)
+	case *Array:
+		vs := make([]interface{}, 0, len(n.nodes))
+		for _, n := range n.nodes {
+			v, err := d.decodeOrderedValue(n)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+		return vs, nil
+	case *Literal:
+		var v interface{}
+		err := d.decodeLiteral(n, reflect.ValueOf(&v).Elem())
+		return v, err
+	default:
+		return nil, fmt.Errorf("option: unexpected node type %T", n)
+	}
+}
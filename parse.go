@@ -2,8 +2,11 @@ package toml
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 )
 
 type Parser struct {
@@ -12,9 +15,97 @@ type Parser struct {
 	curr Token
 
 	comment bytes.Buffer
+
+	depth    int
+	maxDepth int
+
+	lint    bool
+	errors  ParseErrorList
+	version Version
+
+	ctx context.Context
 }
 
+// Parse the TOML document from r and returns its root table.
 func Parse(r io.Reader) (Node, error) {
+	p, err := NewParser(r)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse()
+}
+
+// Valid parses the TOML document from r and discards it. It returns nil if the
+// document is valid or the error reported by Parse otherwise.
+func Valid(r io.Reader) error {
+	_, err := Parse(r)
+	return err
+}
+
+// ValidFile checks that the given file is a valid TOML document. Errors are
+// prefixed by the name of the file.
+func ValidFile(file string) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return fileError(file, Valid(r))
+}
+
+// Lint parses the TOML document from r and returns all the errors found in it.
+// Instead of stopping at the first error, the parser records it and resumes at
+// the next line or at the next table header. Each error is a ParseError giving
+// the position where it has been found.
+func Lint(r io.Reader) []error {
+	p, err := NewParser(r)
+	if err != nil {
+		return []error{err}
+	}
+	p.lint = true
+	p.Parse()
+
+	var errs []error
+	for _, e := range p.errors {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+// ParseError is an error found by the parser in a document and the position
+// where it has been found.
+type ParseError struct {
+	Pos     Position
+	Message string
+
+	err error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s %s", e.Pos, e.Message)
+}
+
+func (e ParseError) Unwrap() error {
+	return e.err
+}
+
+// ParseErrorList is the error returned by Parse when the parser collects all
+// the errors of a document (see SetCollectErrors).
+type ParseErrorList []ParseError
+
+func (es ParseErrorList) Error() string {
+	switch len(es) {
+	case 0:
+		return "no errors"
+	case 1:
+		return es[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", es[0], len(es)-1)
+	}
+}
+
+// Create a new Parser that reads its TOML document from r.
+func NewParser(r io.Reader) (*Parser, error) {
 	s, err := NewScanner(r)
 	if err != nil {
 		return nil, err
@@ -24,19 +115,62 @@ func Parse(r io.Reader) (Node, error) {
 	p.next()
 	p.next()
 
-	return p.Parse()
+	return &p, nil
+}
+
+// SetMaxKeyDepth limits the number of segments of dotted keys and of table
+// headers. A key with more than n segments makes the parser fail. A value of
+// 0 or less means no limit.
+func (p *Parser) SetMaxKeyDepth(n int) {
+	p.maxDepth = n
+}
+
+// SetCollectErrors tells the parser to continue after an error instead of
+// stopping at the first one. The parser resumes at the next line or at the
+// next table header and Parse returns all the errors in a ParseErrorList.
+func (p *Parser) SetCollectErrors(collect bool) {
+	p.lint = collect
 }
 
+// Version is a version of the TOML specification.
+type Version int
+
+const (
+	// V10 is TOML 1.0, the version used by default.
+	V10 Version = iota
+	// V11 is TOML 1.1 (draft): inline tables can be written on multiple lines
+	// and end with a trailing comma.
+	V11
+)
+
+// SetVersion tells the parser which version of the TOML specification the
+// document follows. Comments found in an inline table written on multiple
+// lines (TOML 1.1) are discarded.
+func (p *Parser) SetVersion(v Version) {
+	p.version = v
+}
+
+// Parse parses the whole document and gives its root table. The scanner of the
+// parser is closed when Parse returns, even on error.
 func (p *Parser) Parse() (Node, error) {
+	defer p.scan.Close()
+
 	t := Table{
 		kind: tableRegular,
 	}
+	p.parseHeader(&t)
 	if err := p.parseOptions(&t); err != nil {
 		return nil, err
 	}
 	for !p.isDone() {
+		if err := p.canceled(); err != nil {
+			return nil, err
+		}
 		if !p.curr.isTable() {
-			return nil, p.unexpectedToken("'[, [['", "parse")
+			if err := p.resync(p.unexpectedToken("'[, [['", "parse")); err != nil {
+				return nil, err
+			}
+			continue
 		}
 		kind := tableRegular
 		if p.curr.Type == TokBegArrayTable {
@@ -44,33 +178,47 @@ func (p *Parser) Parse() (Node, error) {
 		}
 		p.next()
 		if err := p.parseTable(&t, kind); err != nil {
-			return nil, err
+			if err = p.resync(err); err != nil {
+				return nil, err
+			}
+			// options of an invalid table are still checked
+			if err = p.parseOptions(&Table{kind: tableRegular}); err != nil {
+				return nil, err
+			}
 		}
 	}
+	if len(p.errors) > 0 {
+		return nil, p.errors
+	}
+	t.eol = p.scan.EOL()
 	return &t, nil
 }
 
 func (p *Parser) parseTable(t *Table, kind tableType) error {
 Loop:
 	for !p.isDone() {
-		if !p.curr.IsIdent() {
+		if !p.curr.IsKey() {
 			return p.unexpectedToken("ident", "table")
 		}
 		switch p.peek.Type {
 		case TokDot:
+			if err := p.enterKey("table"); err != nil {
+				return err
+			}
 			x, err := t.retrieveTable(p.curr)
 			if err != nil {
-				return err
+				return keyError(p.curr, err)
 			}
 			t = x
 			p.next()
 		case TokEndRegularTable, TokEndArrayTable:
+			p.depth = 0
 			x := &Table{
 				key:  p.curr,
 				kind: kind,
 			}
 			if err := t.registerTable(x); err != nil {
-				return err
+				return keyError(x.key, err)
 			}
 			t = x
 			if t.kind == tableItem && p.peek.Type != TokEndArrayTable {
@@ -84,30 +232,65 @@ Loop:
 				p.next()
 			}
 			t.withComment(p.comment.String(), comment)
+			p.comment.Reset()
 			break Loop
 		default:
 			return p.unexpectedToken("'], .'", "table")
 		}
 		p.next()
 	}
-	if !p.curr.isNL() {
+	if !p.isEOL() {
 		return p.unexpectedToken("'\\n'", "table")
 	}
+	// the source of the table starts after the newline ending its header
+	offset := p.curr.Offset + 1
 	p.next()
-	return p.parseOptions(t)
+	if err := p.parseOptions(t); err != nil {
+		return err
+	}
+	t.raw = p.source(offset)
+	return nil
+}
+
+// source gives the source of the document from the given offset to the
+// beginning of the line of the current token.
+func (p *Parser) source(offset int) string {
+	var (
+		src = p.scan.Source()
+		end = p.curr.Offset
+	)
+	if end > len(src) {
+		end = len(src)
+	}
+	if offset >= end {
+		return ""
+	}
+	if !p.isDone() {
+		end = offset + bytes.LastIndexByte(src[offset:end], '\n') + 1
+	}
+	return string(src[offset:end])
 }
 
 func (p *Parser) parseOptions(t *Table) error {
 	for {
-		p.parseComment()
+		if err := p.canceled(); err != nil {
+			return err
+		}
+		if p.curr.isComment() {
+			p.parseComment()
+		}
 		if p.curr.isTable() || p.isDone() {
 			break
 		}
-		if err := p.parseOption(t, true); err != nil {
-			return err
+		err := p.parseOption(t, true)
+		if err == nil && !p.isEOL() {
+			err = p.unexpectedToken("'\\n'", "body")
 		}
-		if !p.curr.isNL() {
-			return p.unexpectedToken("'\\n'", "body")
+		if err != nil {
+			if err = p.resync(err); err != nil {
+				return err
+			}
+			continue
 		}
 		p.next()
 	}
@@ -118,18 +301,22 @@ func (p *Parser) parseOptions(t *Table) error {
 }
 
 func (p *Parser) parseOption(t *Table, dotted bool) error {
-	if !p.curr.IsIdent() {
+	if !p.curr.IsKey() {
 		return p.unexpectedToken("ident", "option")
 	}
 	if p.peek.Type == TokDot && dotted {
+		if err := p.enterKey("option"); err != nil {
+			return err
+		}
 		x, err := t.retrieveTable(p.curr)
 		if err != nil {
-			return err
+			return keyError(p.curr, err)
 		}
 		p.next()
 		p.next()
 		return p.parseOption(x, dotted)
 	}
+	p.depth = 0
 	var (
 		opt  = Option{key: p.curr}
 		pre  string
@@ -157,14 +344,17 @@ func (p *Parser) parseOption(t *Table, dotted bool) error {
 		p.next()
 	}
 	opt.withComment(pre, post)
-	if err == nil {
-		err = t.registerOption(&opt)
+	if err != nil {
+		return err
 	}
-	return err
+	if err := t.registerOption(&opt); err != nil {
+		return keyError(opt.key, err)
+	}
+	return nil
 }
 
 func (p *Parser) parseLiteral() (Node, error) {
-	if !p.curr.isValue() {
+	if !p.curr.IsValue() {
 		return nil, p.unexpectedToken("literal", "value")
 	}
 	lit := Literal{
@@ -232,12 +422,27 @@ func (p *Parser) parseInline() (Node, error) {
 		kind: tableInline,
 	}
 	for !p.isDone() && p.curr.Type != TokEndInline {
+		if err := p.skipInlineBreaks(); err != nil {
+			return nil, err
+		}
+		if p.curr.Type == TokEndInline {
+			break
+		}
 		if err := p.parseOption(&t, false); err != nil {
 			return nil, err
 		}
+		if err := p.skipInlineBreaks(); err != nil {
+			return nil, err
+		}
 		switch p.curr.Type {
 		case TokComma:
 			p.next()
+			if err := p.skipInlineBreaks(); err != nil {
+				return nil, err
+			}
+			if p.curr.Type == TokEndInline && p.version < V11 {
+				return nil, p.unexpectedToken("key", "inline")
+			}
 		case TokEndInline:
 		default:
 			return nil, p.unexpectedToken("',, }'", "inline")
@@ -250,6 +455,45 @@ func (p *Parser) parseInline() (Node, error) {
 	return &t, nil
 }
 
+// skipInlineBreaks skips the newlines and the comments of an inline table. They
+// are only allowed since TOML 1.1.
+func (p *Parser) skipInlineBreaks() error {
+	for p.curr.isNL() || p.curr.isComment() {
+		if p.version < V11 {
+			return p.unexpectedToken("',, }'", "inline")
+		}
+		p.next()
+	}
+	return nil
+}
+
+// parseHeader keeps the comments at the top of the document as the comment of
+// the root table when they are separated by an empty line from what follows.
+// Otherwise, the comments are left to the first option or table.
+func (p *Parser) parseHeader(t *Table) {
+	var blank bool
+	p.comment.Reset()
+	for i := 0; p.curr.isComment(); i++ {
+		if i > 0 {
+			p.comment.WriteRune(newline)
+		}
+		p.comment.WriteString(p.curr.Literal)
+		p.next()
+		if p.curr.Type != TokNL {
+			continue
+		}
+		blank = strings.Count(p.curr.Raw, "\n") > 1
+		p.next()
+		if blank {
+			break
+		}
+	}
+	if p.comment.Len() > 0 && (blank || p.isDone()) {
+		t.withComment(p.comment.String(), "")
+		p.comment.Reset()
+	}
+}
+
 func (p *Parser) parseComment() {
 	p.comment.Reset()
 	for i := 0; p.curr.isComment(); i++ {
@@ -264,6 +508,40 @@ func (p *Parser) parseComment() {
 	}
 }
 
+// canceled gives the error of the context of the parser once it is done.
+func (p *Parser) canceled() error {
+	if p.ctx == nil {
+		return nil
+	}
+	return p.ctx.Err()
+}
+
+// resync records err and moves to the beginning of the next line or of the
+// next table when the parser lints the document. Otherwise err is returned.
+func (p *Parser) resync(err error) error {
+	if !p.lint {
+		return err
+	}
+	pe, ok := err.(ParseError)
+	if !ok {
+		pe = ParseError{
+			Pos:     p.curr.Pos,
+			Message: err.Error(),
+			err:     err,
+		}
+	}
+	p.errors = append(p.errors, pe)
+	p.depth = 0
+	p.comment.Reset()
+	for !p.isDone() && !p.curr.isNL() && !p.curr.isTable() {
+		p.next()
+	}
+	if p.curr.isNL() {
+		p.next()
+	}
+	return nil
+}
+
 func (p *Parser) next() {
 	if p.curr.Type == TokEOF {
 		return
@@ -276,6 +554,35 @@ func (p *Parser) isDone() bool {
 	return p.curr.Type == TokEOF
 }
 
+// isEOL reports whether the current token ends a line. The end of the document
+// is accepted as the end of the last line even without a trailing newline.
+func (p *Parser) isEOL() bool {
+	return p.curr.isNL() || p.isDone()
+}
+
+func (p *Parser) enterKey(ctx string) error {
+	p.depth++
+	if p.maxDepth > 0 && p.depth >= p.maxDepth {
+		return ParseError{
+			Pos:     p.curr.Pos,
+			Message: fmt.Sprintf("[%s]: too many segments in key (max: %d)", ctx, p.maxDepth),
+		}
+	}
+	return nil
+}
+
+// keyError gives err as a ParseError at the position of key.
+func keyError(key Token, err error) error {
+	return ParseError{
+		Pos:     key.Pos,
+		Message: err.Error(),
+		err:     err,
+	}
+}
+
 func (p *Parser) unexpectedToken(want, ctx string) error {
-	return fmt.Errorf("%s [%s]: unexpected token %s (want: %s)", p.curr.Pos, ctx, p.curr, want)
+	return ParseError{
+		Pos:     p.curr.Pos,
+		Message: fmt.Sprintf("[%s]: unexpected token %s (want: %s)", ctx, p.curr, want),
+	}
 }
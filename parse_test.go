@@ -1,9 +1,14 @@
 package toml
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParse(t *testing.T) {
@@ -32,6 +37,12 @@ func TestParse(t *testing.T) {
 		"table4.bad",
 		"table5.bad",
 		"table6.bad",
+		"table7.bad",
+		"table8.bad",
+		"table9.bad",
+		"table10.bad",
+		"table11.bad",
+		"table12.bad",
 		"package",
 		"fruits1",
 		"fruits2",
@@ -60,3 +71,482 @@ func TestParse(t *testing.T) {
 		r.Close()
 	}
 }
+
+func TestParseEOF(t *testing.T) {
+	data := []struct {
+		Input string
+		Valid bool
+	}{
+		{Input: "key = 1", Valid: true},
+		{Input: "key = 1\n", Valid: true},
+		{Input: "key = 1 # comment", Valid: true},
+		{Input: "[table]", Valid: true},
+		{Input: "[table]\nkey = \"value\"", Valid: true},
+		{Input: "key = 1 garbage", Valid: false},
+		{Input: "key = 1 garbage\n", Valid: false},
+		{Input: "key = \"value\" garbage", Valid: false},
+		{Input: "[table]\nkey = 1 garbage", Valid: false},
+		{Input: "key = 1\ngarbage", Valid: false},
+		{Input: "[table] garbage", Valid: false},
+	}
+	for _, d := range data {
+		_, err := Parse(strings.NewReader(d.Input))
+		switch {
+		case d.Valid && err != nil:
+			t.Errorf("%q: unexpected error: %s", d.Input, err)
+		case !d.Valid && err == nil:
+			t.Errorf("%q: invalid document not detected", d.Input)
+		}
+	}
+}
+
+func TestParseTrailingGarbage(t *testing.T) {
+	_, err := Parse(strings.NewReader("key = 1 garbage"))
+	if err == nil {
+		t.Fatalf("trailing garbage not detected")
+	}
+	if want := "1:9 [body]: unexpected token <illegal(garbage)>"; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("unexpected error: want %q, got %q", want, err)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	n, err := Parse(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	root, ok := n.(*Table)
+	if !ok {
+		t.Fatalf("root node is not a table: %T", n)
+	}
+	if !root.isRoot() || !root.isEmpty() {
+		t.Errorf("root table should be empty")
+	}
+}
+
+func TestParseMaxKeyDepth(t *testing.T) {
+	data := []struct {
+		Input string
+		Valid bool
+	}{
+		{Input: "a = 1", Valid: true},
+		{Input: "a.b.c = 1", Valid: true},
+		{Input: "a.b.c.d = 1", Valid: false},
+		{Input: "[a.b.c]\nd = 1", Valid: true},
+		{Input: "[a.b.c.d]", Valid: false},
+		{Input: "[[a.b.c.d]]", Valid: false},
+		{Input: "[a.b]\nc.d = 1", Valid: true},
+		{Input: "a.b.c = 1\nd.e.f = 2", Valid: true},
+		{Input: strings.Repeat("a.", 1000) + "a = 1", Valid: false},
+	}
+	for _, d := range data {
+		p, err := NewParser(strings.NewReader(d.Input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.SetMaxKeyDepth(3)
+		_, err = p.Parse()
+		switch {
+		case d.Valid && err != nil:
+			t.Errorf("%q: unexpected error: %s", d.Input, err)
+		case !d.Valid && err == nil:
+			t.Errorf("%q: too deep key not detected", d.Input)
+		}
+	}
+}
+
+func TestParseRedefineTable(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  string
+	}{
+		{
+			Input: "[x]\na = 1\n[[x]]\nb = 2",
+			Want:  "3:3 x: cannot redefine regular table as array table (originally at 1:2)",
+		},
+		{
+			Input: "[[x]]\na = 1\n[x]\nb = 2",
+			Want:  "3:2 x: cannot redefine array table as regular table (originally at 1:3)",
+		},
+		{
+			Input: "x.a = 1\n[x]\nb = 2",
+			Want:  "2:2 x: table already defined by dotted keys (at 1:1)",
+		},
+		{
+			Input: "[fruit]\nname = \"apple\"\n[fruit]\nname = \"banana\"",
+			Want:  "3:2 fruit: table already defined (at 1:2)",
+		},
+		{
+			Input: "[fruit.apple]\n[fruit]\n[fruit]",
+			Want:  "3:2 fruit: table already defined (at 2:2)",
+		},
+		{
+			Input: "fruit = {name = \"apple\"}\n[fruit]",
+			Want:  "2:2 fruit: option already exists (at 1:1)",
+		},
+	}
+	for _, d := range data {
+		_, err := Parse(strings.NewReader(d.Input))
+		if err == nil {
+			t.Errorf("%q: redefinition not detected", d.Input)
+			continue
+		}
+		if err.Error() != d.Want {
+			t.Errorf("%q: unexpected error: want %q, got %q", d.Input, d.Want, err)
+		}
+	}
+}
+
+func TestParseInlineSingleLine(t *testing.T) {
+	data := []struct {
+		Input string
+		Pos   Position
+	}{
+		{Input: "owner = {name = \"midbel\",\nsite = \"midbel.org\"}", Pos: Position{Line: 1, Column: 26}},
+		{Input: "owner = {\n}", Pos: Position{Line: 1, Column: 10}},
+		{Input: "owner = {name = \"midbel\" # comment\n}", Pos: Position{Line: 1, Column: 35}},
+		{Input: "owner = {name = \"midbel\",}", Pos: Position{Line: 1, Column: 26}},
+	}
+	for _, d := range data {
+		_, err := Parse(strings.NewReader(d.Input))
+		var perr ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: multiline inline table parsed without error (%v)", d.Input, err)
+			continue
+		}
+		if perr.Pos != d.Pos {
+			t.Errorf("%q: error position mismatched: want %s, got %s", d.Input, d.Pos, perr.Pos)
+		}
+	}
+	const doc = "owner = {name = \"midbel\", tags = [\n\"go\",\n\"toml\",\n]}\n"
+	if _, err := Parse(strings.NewReader(doc)); err != nil {
+		t.Errorf("arrays of inline table can be written on multiple lines: %s", err)
+	}
+}
+
+func TestParseInlineDuplicateKeys(t *testing.T) {
+	data := []struct {
+		Input string
+		Pos   Position
+		Want  string
+	}{
+		{
+			Input: "x = {a = 1, a = 2}",
+			Pos:   Position{Line: 1, Column: 13},
+			Want:  "a: option already exists (at 1:6)",
+		},
+		{
+			Input: "y = {b = 1, c = 2, b = 3}",
+			Pos:   Position{Line: 1, Column: 20},
+			Want:  "b: option already exists (at 1:6)",
+		},
+		{
+			Input: "z = {\"a\" = 1, a = 2}",
+			Pos:   Position{Line: 1, Column: 15},
+			Want:  "a: option already exists (at 1:6)",
+		},
+	}
+	for _, d := range data {
+		_, err := Parse(strings.NewReader(d.Input))
+		var perr ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: duplicate key not detected (%v)", d.Input, err)
+			continue
+		}
+		if perr.Pos != d.Pos || perr.Message != d.Want {
+			t.Errorf("%q: unexpected error: want %s %s, got %s", d.Input, d.Pos, d.Want, perr)
+		}
+	}
+	if _, err := Parse(strings.NewReader("x = [{a = 1}, {a = 2}]")); err != nil {
+		t.Errorf("same key in different inline tables: %s", err)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	const doc = `
+owner = {
+	name = "midbel", # maintainer
+	site = "midbel.org",
+}
+empty = {
+}
+`
+	p, err := NewParser(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetVersion(V11)
+	n, err := p.Parse()
+	if err != nil {
+		t.Fatalf("multiline inline table not parsed with TOML 1.1: %s", err)
+	}
+	root := n.(*Table)
+	owner, ok := root.Get("owner")
+	if !ok {
+		t.Fatalf("owner not found")
+	}
+	inline, ok := owner.(*Option).Value().(*Table)
+	if !ok {
+		t.Fatalf("owner is not an inline table")
+	}
+	if keys := inline.Keys(); !reflect.DeepEqual(keys, []string{"name", "site"}) {
+		t.Errorf("keys of inline table mismatched: %q", keys)
+	}
+	if _, err := Parse(strings.NewReader(doc)); err == nil {
+		t.Errorf("multiline inline table parsed with TOML 1.0")
+	}
+}
+
+func TestParseNoLeak(t *testing.T) {
+	const doc = `
+name = "toml"
+version = = "1.0.0"
+
+[dev]
+name = "midbel"
+email = "noreply@midbel.org"
+`
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		if _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Fatalf("invalid document parsed without error")
+		}
+	}
+	var after int
+	for i := 0; i < 50; i++ {
+		if after = runtime.NumGoroutine(); after <= before {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("goroutines leaked: want %d, got %d", before, after)
+}
+
+func TestValid(t *testing.T) {
+	if err := Valid(strings.NewReader("name = \"toml\"\n[dev]\nname = \"midbel\"\n")); err != nil {
+		t.Errorf("unexpected error for valid document: %s", err)
+	}
+	err := Valid(strings.NewReader("name = \"toml\"\nversion = = 1\n"))
+	if err == nil {
+		t.Fatalf("invalid document not detected")
+	}
+	if !strings.HasPrefix(err.Error(), "2:") {
+		t.Errorf("error should give position: %s", err)
+	}
+	if err := ValidFile("testdata/example.toml"); err != nil {
+		t.Errorf("unexpected error for valid file: %s", err)
+	}
+	if err := ValidFile("testdata/table1.bad.toml"); err == nil || !strings.HasPrefix(err.Error(), "testdata/table1.bad.toml: ") {
+		t.Errorf("error should give file name: %v", err)
+	}
+}
+
+func TestLint(t *testing.T) {
+	const doc = `
+name    = "toml"
+version = 1 garbage
+revision = = 18
+
+[dev
+name = "midbel"
+email
+
+[[dependency]]
+repository = "https://github.com/midbel/glob"
+version    = "0.0.0"
+version    = "0.0.1"
+`
+	errs := Lint(strings.NewReader(doc))
+	want := []string{"3:", "4:", "6:", "8:", "13:1 version: option already exists"}
+	if len(errs) != len(want) {
+		t.Fatalf("errors count mismatched: want %d, got %d (%v)", len(want), len(errs), errs)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), want[i]) {
+			t.Errorf("error %d: want %s, got %s", i, want[i], err)
+		}
+	}
+	if errs := Lint(strings.NewReader("name = \"toml\"\n[dev]\nname = \"midbel\"\n")); len(errs) != 0 {
+		t.Errorf("unexpected errors for valid document: %v", errs)
+	}
+}
+
+func TestLintDuplicates(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  string
+	}{
+		{
+			Input: "a = 1\na = 2\n",
+			Want:  "2:1 a: option already exists (at 1:1)",
+		},
+		{
+			Input: "[x]\na = 1\n\n[x]\nb = 2\n",
+			Want:  "4:2 x: table already defined (at 1:2)",
+		},
+		{
+			Input: "name = \"toml\"\nx = {a = 1, a = 2}\n",
+			Want:  "2:13 a: option already exists (at 2:6)",
+		},
+	}
+	for _, d := range data {
+		errs := Lint(strings.NewReader(d.Input))
+		if len(errs) != 1 {
+			t.Errorf("%q: want 1 error, got %d (%v)", d.Input, len(errs), errs)
+			continue
+		}
+		if _, ok := errs[0].(ParseError); !ok {
+			t.Errorf("%q: unexpected error type %T", d.Input, errs[0])
+		}
+		if got := errs[0].Error(); got != d.Want {
+			t.Errorf("%q: want %s, got %s", d.Input, d.Want, got)
+		}
+	}
+}
+
+func TestParseCollectErrors(t *testing.T) {
+	const doc = `
+name    = "toml"
+version = 1 garbage
+revision = = 18
+
+[dev
+name = "midbel"
+email
+
+[[dependency]]
+repository = "https://github.com/midbel/glob"
+version    = "0.0.0"
+version    = "0.0.1"
+`
+	p, err := NewParser(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetCollectErrors(true)
+	_, err = p.Parse()
+
+	var list ParseErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected ParseErrorList, got %T (%v)", err, err)
+	}
+	lines := []int{3, 4, 6, 8, 13}
+	if len(list) != len(lines) {
+		t.Fatalf("errors count mismatched: want %d, got %d (%v)", len(lines), len(list), list)
+	}
+	for i, e := range list {
+		if e.Pos.Line != lines[i] {
+			t.Errorf("error %d: want line %d, got %s (%s)", i, lines[i], e.Pos, e.Message)
+		}
+	}
+	if msg := list[4].Message; msg != "version: option already exists (at 12:1)" {
+		t.Errorf("unexpected message: %s", msg)
+	}
+	if str := err.Error(); !strings.HasSuffix(str, "(and 4 more errors)") {
+		t.Errorf("unexpected error message: %s", str)
+	}
+
+	p, _ = NewParser(strings.NewReader(doc))
+	if _, err := p.Parse(); errors.As(err, &list) {
+		t.Errorf("parser should stop at the first error")
+	}
+}
+
+func TestParseNavigate(t *testing.T) {
+	const doc = `
+version = "1.0.0"
+name    = "toml"
+owner.name = "midbel"
+
+[dev]
+email    = "noreply@midbel.org"
+projects = ["glob", "maestro"]
+
+[[dependency]]
+repository = "https://github.com/midbel/glob"
+
+[[dependency]]
+repository = "https://github.com/midbel/toml"
+`
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := n.(*Table)
+	want := []string{"version", "name", "owner", "dev", "dependency"}
+	if got := root.Keys(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("keys mismatched: want %v, got %v", want, got)
+	}
+	if _, ok := root.Get("license"); ok {
+		t.Errorf("unknown key found")
+	}
+	if n, ok := root.Get("name"); !ok || n.(*Option).Value().(*Literal).Token().Literal != "toml" {
+		t.Errorf("name: unexpected node %v", n)
+	}
+	if n, ok := root.Get("owner"); !ok || n.(*Table).Options()[0].Key() != "name" {
+		t.Errorf("owner: unexpected node %v", n)
+	}
+
+	n, _ = root.Get("dev")
+	dev := n.(*Table)
+	if dev.Key() != "dev" || dev.IsArray() {
+		t.Errorf("dev: unexpected table %s", dev.Key())
+	}
+	n, _ = dev.Get("projects")
+	arr := n.(*Option).Value().(*Array)
+	if arr.Len() != 2 || arr.At(1).(*Literal).Token().Literal != "maestro" {
+		t.Errorf("projects: unexpected array %v", arr)
+	}
+
+	n, _ = root.Get("dependency")
+	deps := n.(*Table)
+	if !deps.IsArray() || len(deps.Keys()) != 0 {
+		t.Fatalf("dependency: array of tables expected")
+	}
+	items := deps.Tables()
+	if len(items) != 2 {
+		t.Fatalf("dependency: want 2 items, got %d", len(items))
+	}
+	n, _ = items[1].Get("repository")
+	if lit := n.(*Option).Value().(*Literal); lit.Token().Raw != `"https://github.com/midbel/toml"` {
+		t.Errorf("repository: unexpected raw value %s", lit.Token().Raw)
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	const doc = `# document header
+
+# name of the package
+# used by the registry
+name = "toml" # required
+
+# developer
+[dev]
+email = "noreply@midbel.org"
+projects = [
+	# first project
+	"glob", # stable
+]
+`
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := n.(*Table)
+	if pre, _ := root.Comments(); pre != "document header" {
+		t.Errorf("root: unexpected comment %q", pre)
+	}
+	opt, _ := root.Get("name")
+	if pre, post := opt.Comments(); pre != "name of the package\nused by the registry" || post != "required" {
+		t.Errorf("name: unexpected comments %q, %q", pre, post)
+	}
+	dev, _ := root.Get("dev")
+	if pre, _ := dev.Comments(); pre != "developer" {
+		t.Errorf("dev: unexpected comment %q", pre)
+	}
+	opt, _ = dev.(*Table).Get("projects")
+	arr := opt.(*Option).Value().(*Array)
+	if pre, post := arr.At(0).Comments(); pre != "first project" || post != "stable" {
+		t.Errorf("projects: unexpected comments %q, %q", pre, post)
+	}
+}
@@ -1,12 +1,19 @@
 package toml
 
 import (
+	"bufio"
 	"bytes"
 	"io"
 	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
 )
 
+// chunkSize is the number of bytes read at once by a streaming scanner.
+const chunkSize = 4096
+
 const (
 	carriage   = '\r'
 	newline    = '\n'
@@ -61,26 +68,125 @@ type Scanner struct {
 		pos Position
 		beg int
 	}
+	// offset of the first byte of input in the document
+	offset int
+	blanks []Position
+	spaces int
+	// number of lines ending with "\r\n" and with a single "\n"
+	crlf int
+	lf   int
+
+	// reader is only set for a streaming scanner. input is then a window on
+	// the document that starts a few bytes before the current token.
+	reader *bufio.Reader
+	chunk  []byte
+	err    error
 
 	queue chan Token
+	done  chan struct{}
 }
 
+// NewScanner creates a Scanner that reads the whole document from r before
+// scanning it, so that Source can give it (the parser needs it to record the
+// source of the tables). Use NewStreamScanner for documents too large to be kept
+// in memory.
 func NewScanner(r io.Reader) (*Scanner, error) {
-	buf, err := ioutil.ReadAll(r)
-	if err != nil {
+	var s Scanner
+	if err := s.Reset(r); err != nil {
 		return nil, err
 	}
+	return &s, nil
+}
+
+// NewStreamScanner creates a Scanner that reads its input from r while it
+// scans instead of reading the whole document first. Only the bytes of the
+// token being scanned are kept in memory so that very large documents can be
+// scanned. Source gives nil for such a scanner.
+func NewStreamScanner(r io.Reader) (*Scanner, error) {
 	s := Scanner{
-		input:  bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n")),
-		line:   1,
-		column: 0,
-		queue:  make(chan Token),
+		reader: bufio.NewReaderSize(r, chunkSize),
+		chunk:  make([]byte, chunkSize),
+	}
+	if err := s.Reset(r); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Reset discards the tokens that have not been scanned yet and prepares the
+// scanner to scan the document read from r, so that a Scanner can be reused
+// (eg: with a sync.Pool). A streaming scanner remains a streaming scanner.
+func (s *Scanner) Reset(r io.Reader) error {
+	s.Close()
+	if s.reader != nil {
+		s.reader.Reset(r)
+		s.input = s.input[:0]
+		s.crlf, s.lf = 0, 0
+	} else {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		s.crlf, s.lf = countEOL(buf)
+		if s.crlf > 0 {
+			buf = bytes.ReplaceAll(buf, []byte("\r\n"), []byte("\n"))
+		}
+		s.input = buf
 	}
+	s.pos, s.next, s.char = 0, 0, 0
+	s.offset = 0
+	s.line, s.column = 1, 0
+	s.where.pos, s.where.beg = Position{}, 0
+	s.blanks, s.spaces = nil, 0
+	s.err = nil
+	s.buf.Reset()
+
+	s.queue = make(chan Token)
+	s.done = make(chan struct{})
 	s.readRune()
 	s.skip(func(r rune) bool { return isBlank(r) || isNL(r) })
+	if err := s.Err(); err != nil {
+		close(s.queue)
+		return err
+	}
 	go s.scan()
 
-	return &s, nil
+	return nil
+}
+
+// EOL gives the sequence used by most of the lines of the input to end: "\r\n"
+// or "\n" (also given when the input has no end of line). A streaming scanner
+// only knows it once Scan has returned a TokEOF token.
+func (s *Scanner) EOL() string {
+	if s.crlf > s.lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func countEOL(buf []byte) (int, int) {
+	var (
+		crlf = bytes.Count(buf, []byte("\r\n"))
+		lf   = bytes.Count(buf, []byte("\n"))
+	)
+	return crlf, lf - crlf
+}
+
+// Close stops the scanning of the document and waits for the goroutine of the
+// scanner to exit. Scan gives a TokEOF token once the scanner is closed. It
+// should be called when the tokens are not read until the end of the document.
+func (s *Scanner) Close() error {
+	if s.queue == nil {
+		return nil
+	}
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	for range s.queue {
+	}
+	return nil
 }
 
 func (s *Scanner) Scan() Token {
@@ -88,10 +194,43 @@ func (s *Scanner) Scan() Token {
 	if !ok {
 		tok.Literal = ""
 		tok.Type = TokEOF
+		tok.Pos = Position{
+			Line:   s.line,
+			Column: s.column,
+		}
+		tok.Offset = s.offset + len(s.input)
 	}
 	return tok
 }
 
+// Source gives the input of the scanner. The sequences "\r\n" of the original
+// input have been replaced by "\n" so that the lines and columns of positions
+// match the returned bytes. It should not be modified.
+func (s *Scanner) Source() []byte {
+	if s.reader != nil {
+		return nil
+	}
+	return s.input
+}
+
+// Err gives the error, other than io.EOF, returned by the reader of a
+// streaming scanner. The scanner stops at the first error as if the end of
+// the document has been reached. It should only be checked once Scan has
+// returned a TokEOF token.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// TrailingBlanks gives the positions of the blanks found at the end of lines
+// (outside of multiline strings). The list is complete once Scan has returned
+// a TokEOF token.
+func (s *Scanner) TrailingBlanks() []Position {
+	return s.blanks
+}
+
 func (s *Scanner) backup() {
 	s.where.pos = Position{
 		Line:   s.line,
@@ -112,28 +251,76 @@ func (s *Scanner) scan() {
 }
 
 func (s *Scanner) readRune() {
+	s.fill()
 	if s.pos >= len(s.input) {
 		s.char = 0
 		return
 	}
+	if s.char == newline {
+		s.line++
+		s.column = 0
+	}
+	if isBlank(s.char) {
+		s.spaces++
+	} else {
+		s.spaces = 0
+	}
 	r, n := utf8.DecodeRune(s.input[s.next:])
 	if r == utf8.RuneError {
 		s.char = 0
 		s.next = len(s.input)
 	}
 	s.char, s.pos, s.next = r, s.next, s.next+n
-	if s.char == newline {
-		s.line++
-		s.column = 0
-	}
 	s.column++
 }
 
 func (s *Scanner) nextRune() rune {
+	s.fill()
 	r, _ := utf8.DecodeRune(s.input[s.next:])
 	return r
 }
 
+// fill reads the next chunks of a streaming scanner until the rune after the
+// current one is complete. The bytes before the current token are dropped
+// except the last rune needed by prevRune.
+func (s *Scanner) fill() {
+	if s.reader == nil || s.err != nil || len(s.input)-s.next >= utf8.UTFMax {
+		return
+	}
+	if drop := s.where.beg - utf8.UTFMax; drop > 0 {
+		s.input = append(s.input[:0], s.input[drop:]...)
+		s.pos -= drop
+		s.next -= drop
+		s.where.beg -= drop
+		s.offset += drop
+	}
+	for len(s.input)-s.next < utf8.UTFMax && s.err == nil {
+		n, err := s.reader.Read(s.chunk)
+		buf := s.chunk[:n]
+		crlf, lf := countEOL(buf)
+		s.crlf += crlf
+		s.lf += lf
+		if len(buf) > 0 && buf[len(buf)-1] == carriage {
+			if next, _ := s.reader.Peek(1); len(next) > 0 && next[0] == newline {
+				buf = buf[:len(buf)-1]
+				// the "\n" will be counted with the next chunk
+				s.crlf++
+				s.lf--
+			}
+		}
+		for {
+			i := bytes.Index(buf, []byte("\r\n"))
+			if i < 0 {
+				break
+			}
+			s.input = append(s.input, buf[:i]...)
+			buf = buf[i+1:]
+		}
+		s.input = append(s.input, buf...)
+		s.err = err
+	}
+}
+
 func (s *Scanner) prevRune() rune {
 	r, _ := utf8.DecodeLastRune(s.input[:s.pos])
 	return r
@@ -149,6 +336,12 @@ func (s *Scanner) skipN(n int, fn func(rune) bool) {
 	}
 }
 
+func (s *Scanner) trailingBlanks() {
+	if n := s.spaces; n > 0 {
+		s.blanks = append(s.blanks, Position{Line: s.line, Column: s.column - n})
+	}
+}
+
 func (s *Scanner) writeRune(char rune) {
 	s.buf.WriteRune(char)
 }
@@ -167,11 +360,32 @@ func (s *Scanner) isDone() bool {
 
 func (s *Scanner) emit(kind rune) {
 	defer s.buf.Reset()
-	s.queue <- Token{
-		Literal: s.literal(),
-		Raw:     string(s.input[s.where.beg:s.pos]),
-		Type:    kind,
-		Pos:     s.where.pos,
+	tok := Token{
+		Raw:    string(s.input[s.where.beg:s.pos]),
+		Type:   kind,
+		Pos:    s.where.pos,
+		Offset: s.offset + s.where.beg,
+	}
+	// most of the tokens (identifiers, numbers,...) have a literal identical to
+	// their raw value. In this case, the same string is used for both.
+	if lit := s.buf.Bytes(); tok.Raw == string(lit) {
+		tok.Literal = tok.Raw
+	} else {
+		tok.Literal = string(lit)
+	}
+	select {
+	case s.queue <- tok:
+	case <-s.done:
+		s.stop()
+	}
+}
+
+// stop moves the scanner to the end of its input so that the scan functions
+// return without reading anything more.
+func (s *Scanner) stop() {
+	s.pos, s.next, s.char = len(s.input), len(s.input), 0
+	if s.err == nil {
+		s.err = io.EOF
 	}
 }
 
@@ -180,7 +394,12 @@ func scanDefault(s *Scanner) ScanFunc {
 	s.backup()
 	switch {
 	case s.char == newline:
-		s.skip(func(r rune) bool { return isBlank(r) || isNL(r) })
+		for isBlank(s.char) || isNL(s.char) {
+			if s.char == newline {
+				s.trailingBlanks()
+			}
+			s.readRune()
+		}
 		s.emit(TokNL)
 	case s.char == lsquare:
 		s.readRune()
@@ -198,7 +417,7 @@ func scanDefault(s *Scanner) ScanFunc {
 			k = TokEndArrayTable
 		}
 		s.skip(isBlank)
-		if !isComment(s.char) && !isNL(s.char) {
+		if !isComment(s.char) && !isNL(s.char) && !s.isDone() {
 			k = TokIllegal
 		}
 		s.emit(k)
@@ -246,6 +465,7 @@ func scanValue(s *Scanner) ScanFunc {
 	}
 	s.skip(isBlank)
 	if isAlpha(s.char) || isQuote(s.char) {
+		s.backup()
 		scanIllegal(s)
 	}
 	return nil
@@ -300,10 +520,18 @@ func scanInline(s *Scanner) {
 	s.readRune()
 	s.skip(isBlank)
 	for !s.isDone() {
+		s.backup()
 		switch {
 		default:
 			scanIllegal(s)
 			return
+		case isNL(s.char):
+			// newlines are only allowed in inline tables since TOML 1.1: the
+			// parser decides whether to accept them
+			s.skip(func(r rune) bool { return isBlank(r) || isNL(r) })
+			s.emit(TokNL)
+		case isComment(s.char):
+			scanComment(s)
 		case s.char == rcurly:
 			s.readRune()
 			s.emit(TokEndInline)
@@ -322,8 +550,6 @@ func scanInline(s *Scanner) {
 			scanDigit(s)
 		case isQuote(s.char):
 			scanString(s)
-		case isComment(s.char):
-			scanComment(s)
 		}
 		s.skip(isBlank)
 	}
@@ -331,9 +557,10 @@ func scanInline(s *Scanner) {
 
 func scanString(s *Scanner) {
 	var (
-		quote = s.char
-		multi bool
-		kind  rune
+		quote  = s.char
+		multi  bool
+		closed bool
+		kind   rune
 	)
 	s.readRune()
 	if multi = s.char == quote && s.nextRune() == quote; multi {
@@ -356,10 +583,12 @@ func scanString(s *Scanner) {
 		if s.char == quote {
 			s.readRune()
 			if !multi {
+				closed = true
 				break
 			}
 			if s.char == quote && s.nextRune() == quote {
 				s.skipN(2, isQuote)
+				closed = true
 				break
 			}
 			s.writeRune(quote)
@@ -375,12 +604,11 @@ func scanString(s *Scanner) {
 				s.writeRune(char)
 				continue
 			}
-			continue
 		}
 		s.writeRune(s.char)
 		s.readRune()
 	}
-	if s.isDone() {
+	if !closed {
 		kind = TokIllegal
 	}
 	s.emit(kind)
@@ -421,14 +649,14 @@ func scanUnicodeEscape(s *Scanner) rune {
 		case s.char >= '0' && s.char <= '9':
 			x = s.char - '0'
 		case s.char >= 'a' && s.char <= 'f':
-			x = s.char - 'a'
+			x = s.char - 'a' + 10
 		case s.char >= 'A' && s.char <= 'F':
-			x = s.char - 'A'
+			x = s.char - 'A' + 10
 		default:
 			return utf8.RuneError
 		}
 		char |= x << offset
-		offset -= step
+		offset -= 4
 	}
 	s.readRune()
 	return char
@@ -477,14 +705,6 @@ func scanDecimal(s *Scanner) {
 		}
 		s.readRune()
 	}
-	if s.char == zero && isDigit(s.nextRune()) {
-		s.readRune()
-		if isDigit(s.char) && s.nextRune() != colon {
-			s.emit(TokIllegal)
-			return
-		}
-		s.writeRune(zero)
-	}
 Loop:
 	for !s.isDone() {
 		switch {
@@ -513,9 +733,69 @@ Loop:
 		}
 		s.readRune()
 	}
+	if isDatetime(kind) && !checkDatetime(kind, s.literal()) {
+		kind = TokIllegal
+	}
+	if (kind == TokInteger || kind == TokFloat) && hasLeadingZero(s.literal()) {
+		kind = TokIllegal
+	}
 	s.emit(kind)
 }
 
+// hasLeadingZero reports whether the integer part of the number lit starts with
+// a zero followed by other digits.
+func hasLeadingZero(lit string) bool {
+	lit = strings.TrimPrefix(lit, string(minus))
+	if i := strings.IndexAny(lit, ".eE"); i >= 0 {
+		lit = lit[:i]
+	}
+	return len(lit) > 1 && lit[0] == zero
+}
+
+func isDatetime(kind rune) bool {
+	return kind == TokDate || kind == TokTime || kind == TokDatetime
+}
+
+// checkDatetime reports whether the fields of the date and/or time lit, as
+// written by scanDate and scanTime, have valid calendar values (month, day of
+// the month, hour, minute, second and timezone offset).
+func checkDatetime(kind rune, lit string) bool {
+	inRange := func(str string, min, max int) bool {
+		n, err := strconv.Atoi(str)
+		return err == nil && n >= min && n <= max
+	}
+	if kind == TokDate || kind == TokDatetime {
+		if len(lit) < 10 || lit[4] != minus {
+			return false
+		}
+		year, err := strconv.Atoi(lit[:4])
+		if err != nil || !inRange(lit[5:7], 1, 12) {
+			return false
+		}
+		month, _ := strconv.Atoi(lit[5:7])
+		days := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if !inRange(lit[8:10], 1, days) {
+			return false
+		}
+		if lit = lit[10:]; kind == TokDatetime && len(lit) > 0 {
+			lit = lit[1:]
+		}
+	}
+	if kind == TokTime || kind == TokDatetime {
+		if len(lit) < 8 {
+			return false
+		}
+		if !inRange(lit[:2], 0, 23) || !inRange(lit[3:5], 0, 59) || !inRange(lit[6:8], 0, 59) {
+			return false
+		}
+		lit = strings.TrimLeft(lit[8:], ".0123456789")
+		if len(lit) == 6 && isSign(rune(lit[0])) {
+			return inRange(lit[1:3], 0, 23) && inRange(lit[4:6], 0, 59)
+		}
+	}
+	return true
+}
+
 func scanDate(s *Scanner) rune {
 	scan := func() bool {
 		if s.char != minus {
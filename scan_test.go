@@ -1,8 +1,14 @@
 package toml
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestScannerScan(t *testing.T) {
@@ -388,3 +394,283 @@ key = "value" illegal = 1234
 		t.Fatalf("last token is not EOF")
 	}
 }
+
+func TestScannerTrailingBlanks(t *testing.T) {
+	const doc = "name = \"toml\"  \n# comment\t\n  \nversion = 1\nstr = \"\"\"\nfoo  \nbar\"\"\"\n"
+
+	s, err := NewScanner(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("fail to prepare scanner: %s", err)
+	}
+	for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+	}
+	want := []Position{
+		{Line: 1, Column: 14},
+		{Line: 2, Column: 10},
+		{Line: 3, Column: 1},
+	}
+	got := s.TrailingBlanks()
+	if len(got) != len(want) {
+		t.Fatalf("trailing blanks: want %d positions, got %d (%v)", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("trailing blanks: want %s, got %s", want[i], got[i])
+		}
+	}
+}
+
+func TestScannerSource(t *testing.T) {
+	const doc = "name = \"toml\"\r\nversion = 1\r\n"
+
+	s, err := NewScanner(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("fail to prepare scanner: %s", err)
+	}
+	want := strings.ReplaceAll(doc, "\r\n", "\n")
+	if got := string(s.Source()); got != want {
+		t.Errorf("source: want %q, got %q", want, got)
+	}
+	for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+		if tok.Type != TokInteger {
+			continue
+		}
+		lines := strings.Split(string(s.Source()), "\n")
+		line := lines[tok.Pos.Line-1]
+		if got := line[tok.Pos.Column-1:]; got != tok.Literal {
+			t.Errorf("source: position %s does not match %q (got %q)", tok.Pos, tok.Literal, got)
+		}
+	}
+}
+
+func TestScannerDatetimeRange(t *testing.T) {
+	data := []struct {
+		Input string
+		Type  rune
+	}{
+		{Input: "1979-05-27T07:32:00Z", Type: TokDatetime},
+		{Input: "1979-05-27 07:32:00.999-07:00", Type: TokDatetime},
+		{Input: "2020-02-29", Type: TokDate},
+		{Input: "23:59:59.999999", Type: TokTime},
+		{Input: "2019-13-45T25:99:99Z", Type: TokIllegal},
+		{Input: "2019-00-10", Type: TokIllegal},
+		{Input: "2019-02-29", Type: TokIllegal},
+		{Input: "2019-04-31", Type: TokIllegal},
+		{Input: "24:00:00", Type: TokIllegal},
+		{Input: "12:60:00", Type: TokIllegal},
+		{Input: "12:00:60", Type: TokIllegal},
+		{Input: "1979-05-27T07:32:00+24:00", Type: TokIllegal},
+	}
+	for _, d := range data {
+		s, err := NewScanner(strings.NewReader("value = " + d.Input))
+		if err != nil {
+			t.Fatalf("fail to prepare scanner: %s", err)
+		}
+		s.Scan()
+		s.Scan()
+		got := s.Scan()
+		s.Close()
+		if got.Type != d.Type {
+			t.Errorf("%s: unexpected token type: want %s, got %s", d.Input, Token{Type: d.Type}, got)
+		}
+		if got.Pos.Line != 1 || got.Pos.Column != 9 {
+			t.Errorf("%s: unexpected position: %s", d.Input, got.Pos)
+		}
+	}
+}
+
+func TestScannerLeadingZeros(t *testing.T) {
+	data := []struct {
+		Input string
+		Type  rune
+	}{
+		{Input: "00", Type: TokIllegal},
+		{Input: "0_0", Type: TokIllegal},
+		{Input: "+01", Type: TokIllegal},
+		{Input: "-00", Type: TokIllegal},
+		{Input: "0123", Type: TokIllegal},
+		{Input: "07", Type: TokIllegal},
+		{Input: "00.14", Type: TokIllegal},
+		{Input: "0", Type: TokInteger},
+		{Input: "+0", Type: TokInteger},
+		{Input: "-0", Type: TokInteger},
+		{Input: "10_000", Type: TokInteger},
+		{Input: "0.14", Type: TokFloat},
+		{Input: "0e10", Type: TokFloat},
+		{Input: "07:32:00", Type: TokTime},
+		{Input: "0001-01-01", Type: TokDate},
+	}
+	for _, d := range data {
+		s, err := NewScanner(strings.NewReader("value = " + d.Input))
+		if err != nil {
+			t.Fatalf("fail to prepare scanner: %s", err)
+		}
+		s.Scan()
+		s.Scan()
+		got := s.Scan()
+		s.Close()
+		if got.Type != d.Type {
+			t.Errorf("%s: unexpected token type: want %s, got %s", d.Input, Token{Type: d.Type}, got)
+		}
+	}
+}
+
+func TestStreamScanner(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crlf := bytes.ReplaceAll(buf, []byte("\n"), []byte("\r\n"))
+		for _, doc := range [][]byte{buf, crlf} {
+			s, err := NewScanner(bytes.NewReader(doc))
+			if err != nil {
+				t.Fatalf("%s: fail to prepare scanner: %s", f, err)
+			}
+			ss, err := NewStreamScanner(iotest.OneByteReader(bytes.NewReader(doc)))
+			if err != nil {
+				t.Fatalf("%s: fail to prepare stream scanner: %s", f, err)
+			}
+			for {
+				want, got := s.Scan(), ss.Scan()
+				if want != got {
+					t.Errorf("%s: token mismatched: want %s (%s), got %s (%s)", f, want, want.Pos, got, got.Pos)
+					break
+				}
+				if want.Type == TokEOF {
+					break
+				}
+				if src := s.Source()[want.Offset:]; !bytes.HasPrefix(src, []byte(want.Raw)) {
+					t.Errorf("%s: token %s not found at offset %d", f, want, want.Offset)
+				}
+			}
+			want, got := s.TrailingBlanks(), ss.TrailingBlanks()
+			if len(want) != len(got) {
+				t.Errorf("%s: trailing blanks mismatched: want %v, got %v", f, want, got)
+			}
+			if eol := ss.EOL(); eol != s.EOL() || (bytes.Contains(doc, []byte("\r\n")) && eol != "\r\n") {
+				t.Errorf("%s: end of line mismatched: want %q, got %q", f, s.EOL(), eol)
+			}
+			if ss.Source() != nil || ss.Err() != nil {
+				t.Errorf("%s: stream scanner should not keep its source nor fail", f)
+			}
+		}
+	}
+}
+
+func TestScannerReset(t *testing.T) {
+	const (
+		doc1 = "name = \"toml\"\nversion = 1\n"
+		doc2 = "# comment\nlicense = \"MIT\""
+	)
+	collect := func(s *Scanner) []Token {
+		var list []Token
+		for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+			list = append(list, tok)
+		}
+		return list
+	}
+	ctor := map[string]func(io.Reader) (*Scanner, error){
+		"default": NewScanner,
+		"stream":  NewStreamScanner,
+	}
+	for name, fn := range ctor {
+		s, err := fn(strings.NewReader(doc2))
+		if err != nil {
+			t.Fatalf("%s: fail to prepare scanner: %s", name, err)
+		}
+		want := collect(s)
+
+		s, err = fn(strings.NewReader(doc1))
+		if err != nil {
+			t.Fatalf("%s: fail to prepare scanner: %s", name, err)
+		}
+		s.Scan()
+		if err := s.Reset(strings.NewReader(doc2)); err != nil {
+			t.Fatalf("%s: fail to reset scanner: %s", name, err)
+		}
+		got := collect(s)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: tokens mismatched after reset: want %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestScannerClose(t *testing.T) {
+	const doc = "name = \"toml\"\nversion = 1\n"
+
+	s, err := NewScanner(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("fail to prepare scanner: %s", err)
+	}
+	if tok := s.Scan(); tok.Type != TokIdent {
+		t.Fatalf("unexpected first token: %s", tok)
+	}
+	s.Close()
+	for i := 0; i < 2; i++ {
+		if tok := s.Scan(); tok.Type != TokEOF {
+			t.Errorf("closed scanner gives %s instead of EOF", tok)
+		}
+	}
+	if got := string(s.Source()); got != doc {
+		t.Errorf("source modified by close: want %q, got %q", doc, got)
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.toml"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var docs [][]byte
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs = append(docs, buf)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			s, err := NewScanner(bytes.NewReader(doc))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+			}
+		}
+	}
+}
+
+func BenchmarkStreamScanner(b *testing.B) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.toml"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	var docs [][]byte
+	for _, f := range files {
+		buf, err := ioutil.ReadFile(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs = append(docs, buf)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			s, err := NewStreamScanner(bytes.NewReader(doc))
+			if err != nil {
+				b.Fatal(err)
+			}
+			for tok := s.Scan(); tok.Type != TokEOF; tok = s.Scan() {
+			}
+		}
+	}
+}
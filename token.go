@@ -67,6 +67,9 @@ func (p Position) String() string {
 }
 
 func (p Position) Less(other Position) bool {
+	if p.Line == other.Line {
+		return p.Column < other.Column
+	}
 	return p.Line < other.Line
 }
 
@@ -75,6 +78,9 @@ type Token struct {
 	Raw     string
 	Type    rune
 	Pos     Position
+	// Offset is the offset in bytes of the token in the document once its
+	// "\r\n" have been replaced by "\n" (see Scanner.Source).
+	Offset int
 }
 
 func (t Token) isZero() bool {
@@ -93,7 +99,10 @@ func (t Token) isTable() bool {
 	return t.Type == TokBegRegularTable || t.Type == TokBegArrayTable
 }
 
-func (t Token) IsIdent() bool {
+// IsKey reports whether the token can be used as a key or as a segment of a
+// dotted key: bare keys (TokIdent), quoted keys (TokBasic, TokLiteral,
+// TokString) and keys only made of digits (TokInteger).
+func (t Token) IsKey() bool {
 	switch t.Type {
 	case TokIdent, TokString, TokBasic, TokLiteral, TokInteger:
 		return true
@@ -102,18 +111,28 @@ func (t Token) IsIdent() bool {
 	}
 }
 
-func (t Token) isValue() bool {
-	switch t.Type {
-	case TokInteger, TokFloat, TokBool, TokDate, TokTime, TokDatetime:
-		return true
-	case TokString, TokBasic, TokLiteral, TokBasicMulti, TokLiteralMulti:
-		return true
-	default:
-		return false
-	}
+// IsIdent is an alias of IsKey kept for compatibility. Despite its name, it
+// also reports quoted keys and integers since they are valid keys.
+func (t Token) IsIdent() bool {
+	return t.IsKey()
+}
+
+// IsKeyStart reports whether the token can start a new line of a document: a
+// key (see IsKey) or the opening bracket(s) of a table header.
+func (t Token) IsKeyStart() bool {
+	return t.IsKey() || t.isTable()
+}
+
+// IsValue reports whether the token is a literal value: strings (TokBasic,
+// TokLiteral, TokBasicMulti, TokLiteralMulti, TokString), numbers (TokInteger,
+// TokFloat), booleans (TokBool) and dates/times (TokDate, TokTime, TokDatetime).
+func (t Token) IsValue() bool {
+	return t.IsString() || t.IsNumber() || t.IsTime() || t.Type == TokBool
 }
 
-func (t Token) isString() bool {
+// IsString reports whether the token is a string of any kind: TokBasic,
+// TokLiteral, TokBasicMulti, TokLiteralMulti or TokString.
+func (t Token) IsString() bool {
 	switch t.Type {
 	case TokString, TokBasic, TokLiteral, TokBasicMulti, TokLiteralMulti:
 		return true
@@ -122,14 +141,17 @@ func (t Token) isString() bool {
 	}
 }
 
+// IsValid reports whether the token is not TokIllegal.
 func (t Token) IsValid() bool {
 	return t.Type != TokIllegal
 }
 
+// IsNumber reports whether the token is a TokInteger or a TokFloat.
 func (t Token) IsNumber() bool {
 	return t.Type == TokInteger || t.Type == TokFloat
 }
 
+// IsTime reports whether the token is a TokDatetime, a TokDate or a TokTime.
 func (t Token) IsTime() bool {
 	return t.Type == TokDatetime || t.Type == TokDate || t.Type == TokTime
 }
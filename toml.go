@@ -1,12 +1,15 @@
 package toml
 
 import (
+	"context"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,69 +17,554 @@ import (
 
 var ErrUndefined = errors.New("undefined")
 
+// DecodeError describes a value of a document that can not be decoded. Key is
+// the dotted path of the option and Pos the position of the value (or of the
+// option when the value is not a literal) in the document. Err is the
+// underlying error (returned by strconv for example).
+type DecodeError struct {
+	Key string
+	Pos Position
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Pos, e.Key, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
 // Decode a TOML document from the given file and writes the decode values into v.
-// See Decode for more information about the decoding process.
+// See Decode for more information about the decoding process. Errors found in
+// the document are prefixed by the name of the file.
 func DecodeFile(file string, v interface{}) error {
 	r, err := os.Open(file)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
-	return Decode(r, v)
+	return fileError(file, Decode(r, v))
+}
+
+// DecodeStrictFile decodes the TOML document from the given file into v. Unlike
+// DecodeFile, which stops at the first key of the document that does not match
+// a field of the destination value, it decodes the whole document and reports
+// all these keys in an UnknownKeysError (see Decoder.DisallowUnknownFields).
+func DecodeStrictFile(file string, v interface{}) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	d := NewDecoder(r)
+	d.DisallowUnknownFields()
+	return fileError(file, d.Decode(v))
+}
+
+// DecodeFirst decodes into v the first file of paths that exists and returns
+// its name. Files that do not exist are skipped but the search stops at the
+// first file that can not be opened or decoded.
+func DecodeFirst(paths []string, v interface{}) (string, error) {
+	for _, file := range paths {
+		r, err := os.Open(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return file, err
+		}
+		err = Decode(r, v)
+		r.Close()
+		return file, fileError(file, err)
+	}
+	return "", fmt.Errorf("%s: %w", strings.Join(paths, ", "), os.ErrNotExist)
+}
+
+func fileError(file string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", file, err)
 }
 
 // Decode a TOML document from r and writes the decoded values into v.
+//
+// A string field with the raw option (eg: `toml:",raw"`) receives the source of
+// its table, from the line after the header to the next header, instead of
+// its decoded options. Decoding fails if the table has no header of its own
+// (eg: a table only defined by dotted keys).
+//
+// Local dates, local times and local date times can be decoded into Date, Time
+// and DateTime. Unlike time.Time, these types keep them apart from offset date
+// times.
 func Decode(r io.Reader, v interface{}) error {
-	n, err := Parse(r)
+	return NewDecoder(r).Decode(v)
+}
+
+// DecodeContext decodes a TOML document from r like Decode but stops as soon as
+// ctx is done. In that case, the error of ctx is returned.
+func DecodeContext(ctx context.Context, r io.Reader, v interface{}) error {
+	return NewDecoder(r).DecodeContext(ctx, v)
+}
+
+// DecodeSection decodes only the table of the TOML document found at the given
+// dotted path into v. See Decode for more information about the decoding process.
+func DecodeSection(r io.Reader, path string, v interface{}) error {
+	return NewDecoder(r).DecodeSection(path, v)
+}
+
+// KeyPos gives the dotted path of a key found in a document and the position
+// where it has been defined.
+type KeyPos struct {
+	Key string
+	Pos Position
+}
+
+// UnknownKeysError is returned by a Decoder that disallows unknown fields. It
+// lists all the keys of the document that do not match a field of a struct.
+type UnknownKeysError struct {
+	Keys []KeyPos
+}
+
+func (e *UnknownKeysError) Error() string {
+	var str strings.Builder
+	for i, k := range e.Keys {
+		if i > 0 {
+			str.WriteString(", ")
+		}
+		str.WriteString(k.Pos.String())
+		str.WriteString(" ")
+		str.WriteString(k.Key)
+	}
+	return fmt.Sprintf("%s keys: %s", ErrUndefined, str.String())
+}
+
+func (e *UnknownKeysError) Unwrap() error {
+	return ErrUndefined
+}
+
+// Report lists the keys of a document that have been decoded (Used) and the
+// ones that do not match any field of the destination value (Unused). Keys are
+// ordered by their position in the document.
+type Report struct {
+	Used   []KeyPos
+	Unused []KeyPos
+}
+
+func (r *Report) use(key string, pos Position) {
+	r.Used = append(r.Used, KeyPos{Key: key, Pos: pos})
+}
+
+func (r *Report) unuse(key string, pos Position) {
+	r.Unused = append(r.Unused, KeyPos{Key: key, Pos: pos})
+}
+
+func (r *Report) sort() {
+	less := func(vs []KeyPos) func(int, int) bool {
+		return func(i, j int) bool {
+			pi, pj := vs[i].Pos, vs[j].Pos
+			if pi.Line == pj.Line {
+				return pi.Column < pj.Column
+			}
+			return pi.Line < pj.Line
+		}
+	}
+	sort.SliceStable(r.Used, less(r.Used))
+	sort.SliceStable(r.Unused, less(r.Unused))
+}
+
+// Decoder reads and decodes a TOML document from an input stream.
+type Decoder struct {
+	r io.Reader
+
+	path      []string
+	report    Report
+	collect   bool
+	unknown   bool
+	unknowns  []KeyPos
+	allowOpts bool
+	allowTabs bool
+	useNumber bool
+	skipEmpty bool
+	resolve   func(reflect.Type, string) (string, bool)
+	match     func(reflect.StructField, string) bool
+	ctx       context.Context
+	hooks     map[reflect.Type]func(interface{}) error
+	funcs     map[reflect.Type]map[string]interface{}
+}
+
+// Create a new Decoder that reads its TOML document from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode the TOML document and writes the decoded values into v. Keys of the
+// document that do not match a field of a struct are reported as an error.
+func (d *Decoder) Decode(v interface{}) error {
+	root, err := d.parse()
 	if err != nil {
 		return err
 	}
+	return d.decodeRoot(root, v)
+}
+
+// DecodeContext decodes the TOML document like Decode. The parsing and the
+// decoding are stopped as soon as ctx is done and the error of ctx is returned.
+func (d *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	d.ctx = ctx
+	defer func() {
+		d.ctx = nil
+	}()
+	return d.Decode(v)
+}
+
+// DecodeSection decodes only the table found at the given dotted path (eg:
+// "server.logging") of the TOML document into v. Segments of the path can be
+// quoted like the keys of a document.
+func (d *Decoder) DecodeSection(path string, v interface{}) error {
+	root, err := d.parse()
+	if err != nil {
+		return err
+	}
+	keys, err := splitKey(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		d.path = d.path[:0]
+	}()
+	for _, key := range keys {
+		var next *Table
+		if at := searchNodes(key, root.nodes); at < len(root.nodes) {
+			next, _ = root.nodes[at].(*Table)
+		}
+		if next == nil || next.key.Literal != key {
+			return fmt.Errorf("%s: %w table", path, ErrUndefined)
+		}
+		if next.isArray() || next.kind == tableInline {
+			return fmt.Errorf("%s: not a regular table", path)
+		}
+		root = next
+		d.enter(key)
+	}
+	return d.decodeRoot(root, v)
+}
+
+func (d *Decoder) parse() (*Table, error) {
+	p, err := NewParser(d.r)
+	if err != nil {
+		return nil, err
+	}
+	p.ctx = d.ctx
+	n, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
 	root, ok := n.(*Table)
 	if !ok {
-		return fmt.Errorf("root node is not a table!") // should never happen
+		return nil, fmt.Errorf("root node is not a table!") // should never happen
 	}
+	return root, nil
+}
+
+func (d *Decoder) decodeRoot(root *Table, v interface{}) error {
+	d.report = Report{}
+	defer func() {
+		d.unknowns = nil
+		d.report.sort()
+	}()
 	e := reflect.ValueOf(v)
 	if e.Kind() != reflect.Ptr || e.IsNil() {
 		return fmt.Errorf("invalid given type %s", e.Type())
 	}
+	var err error
 	if e.Kind() == reflect.Interface && e.NumMethod() == 0 {
 		var (
 			m  = make(map[string]interface{})
 			me = reflect.ValueOf(m).Elem()
 		)
-		if err = decodeMap(root, me); err == nil {
+		if err = d.decodeMap(root, me); err == nil {
 			e.Set(me)
 		}
 	} else {
-		err = decodeTable(root, e.Elem())
+		err = d.decodeTable(root, e.Elem())
+	}
+	if err == nil {
+		err = d.decoded(e.Elem())
+	}
+	if err == nil && len(d.unknowns) > 0 {
+		rpt := Report{Unused: d.unknowns}
+		rpt.sort()
+		err = &UnknownKeysError{Keys: rpt.Unused}
 	}
 	return err
 }
 
-func decodeTable(t *Table, e reflect.Value) error {
+// DecodeReport decodes the TOML document like Decode but, instead of failing
+// on keys that do not match any field of a struct, it collects them into the
+// returned Report alongside with the keys that have been decoded.
+func (d *Decoder) DecodeReport(v interface{}) (*Report, error) {
+	d.collect = true
+	defer func() {
+		d.collect = false
+	}()
+	if err := d.Decode(v); err != nil {
+		return nil, err
+	}
+	rpt := d.report
+	return &rpt, nil
+}
+
+// Metadata gives the keys of the document seen by the last call to one of the
+// Decode methods of the decoder.
+func (d *Decoder) Metadata() Metadata {
+	return Metadata{keys: d.report}
+}
+
+// Metadata lists the dotted keys of a decoded document in their order of
+// appearance. Keys of the elements of an array of tables are given once. It is
+// built on the Report of the decoder (see DecodeReport): Keys gives its Used and
+// Unused keys and Undecoded only its Unused keys.
+type Metadata struct {
+	keys Report
+}
+
+// Keys gives all the keys of the document that have been seen by the decoder,
+// decoded or not. Keys of an unknown table are not given, only the key of the
+// table itself.
+func (m Metadata) Keys() []string {
+	vs := make([]KeyPos, 0, len(m.keys.Used)+len(m.keys.Unused))
+	vs = append(vs, m.keys.Used...)
+	vs = append(vs, m.keys.Unused...)
+	rpt := Report{Used: vs}
+	rpt.sort()
+	return uniqKeys(rpt.Used)
+}
+
+// Undecoded gives the keys of the document that have not been decoded because
+// they do not match any field of the destination value.
+func (m Metadata) Undecoded() []string {
+	return uniqKeys(m.keys.Unused)
+}
+
+func uniqKeys(vs []KeyPos) []string {
+	var (
+		keys = make([]string, 0, len(vs))
+		seen = make(map[string]struct{})
+	)
+	for _, k := range vs {
+		if _, ok := seen[k.Key]; ok {
+			continue
+		}
+		seen[k.Key] = struct{}{}
+		keys = append(keys, k.Key)
+	}
+	return keys
+}
+
+// DisallowUnknownFields tells the decoder to check the whole document before
+// reporting the keys that do not match a field of a struct. The error returned
+// is then an UnknownKeysError listing all these keys with their position. By
+// default, the decoding stops at the first unknown key.
+func (d *Decoder) DisallowUnknownFields() {
+	d.unknown = true
+}
+
+// SetAllowUnknownOptions tells the decoder to ignore the options of the
+// document that do not match a field of a struct. Unknown tables are still
+// reported as errors unless allowed with SetAllowUnknownTables.
+func (d *Decoder) SetAllowUnknownOptions(allow bool) {
+	d.allowOpts = allow
+}
+
+// SetAllowUnknownTables tells the decoder to ignore the tables (and arrays of
+// tables) of the document that do not match a field of a struct.
+func (d *Decoder) SetAllowUnknownTables(allow bool) {
+	d.allowTabs = allow
+}
+
+// UseNumber tells the decoder to decode integers and floats into a Number
+// instead of an int64 or a float64 when the destination is an interface{}.
+// Destinations of type Number always receive a Number.
+func (d *Decoder) UseNumber() {
+	d.useNumber = true
+}
+
+// SetSkipEmpty tells the decoder to not overwrite a field of a struct that
+// already holds a non zero value with an empty value of the document (empty
+// string or array, false, 0, ...). It allows to decode a document on top of a
+// value already filled from another source.
+func (d *Decoder) SetSkipEmpty(skip bool) {
+	d.skipEmpty = skip
+}
+
+// SetFieldResolver registers fn to map the keys of a document to the fields of
+// a struct. fn receives the type of the struct and the key and gives the name
+// of the field that should receive the value. When fn returns false, the key
+// is matched with the fields of the struct as usual.
+//
+// fn takes precedence over the names and tags of the fields and over MatchKey:
+// a key mapped by fn to a name that is not a field of the struct is unknown.
+func (d *Decoder) SetFieldResolver(fn func(reflect.Type, string) (string, bool)) {
+	d.resolve = fn
+}
+
+// MatchKey registers fn to match the keys of a document that have no field with
+// the same name (or tag) in a struct. fn is called with the fields of the struct
+// in their declaration order and the first one for which it returns true
+// receives the value. It allows to match keys written in snake case or with a
+// different case without tagging every field.
+//
+// fn is the last resort: it is only called for keys that the resolver of
+// SetFieldResolver does not map and that match no field name or tag.
+func (d *Decoder) MatchKey(fn func(reflect.StructField, string) bool) {
+	d.match = fn
+}
+
+// OnDecode registers fn to be called each time a value of type typ has been
+// decoded. fn receives a pointer to the decoded value when it is addressable,
+// the value itself otherwise. An error returned by fn stops the decoding.
+func (d *Decoder) OnDecode(typ reflect.Type, fn func(interface{}) error) {
+	if d.hooks == nil {
+		d.hooks = make(map[reflect.Type]func(interface{}) error)
+	}
+	d.hooks[typ] = fn
+}
+
+// RegisterFunc registers the values that can be given to a field of type typ
+// (typically a func, an interface or an enum type). When such a field receives
+// a string, the string is used as a name to select the value from values.
+// Integer values are converted to typ when typ is an integer type.
+func (d *Decoder) RegisterFunc(typ reflect.Type, values map[string]interface{}) {
+	if d.funcs == nil {
+		d.funcs = make(map[reflect.Type]map[string]interface{})
+	}
+	d.funcs[typ] = values
+}
+
+func (d *Decoder) decodeFunc(e reflect.Value, name string, values map[string]interface{}) error {
+	fn, ok := values[name]
+	if !ok {
+		return fmt.Errorf("%s: no value registered for %s", name, e.Type())
+	}
+	v := reflect.ValueOf(fn)
+	if v.IsValid() && isInteger(v.Kind()) && isInteger(e.Kind()) {
+		v = v.Convert(e.Type())
+	}
+	if !v.IsValid() || !v.Type().AssignableTo(e.Type()) {
+		return fmt.Errorf("%s: value of type %T can not be assigned to %s", name, fn, e.Type())
+	}
+	e.Set(v)
+	return nil
+}
+
+func (d *Decoder) decoded(e reflect.Value) error {
+	fn, ok := d.hooks[e.Type()]
+	if !ok {
+		return nil
+	}
+	v := e.Interface()
+	if e.CanAddr() {
+		v = e.Addr().Interface()
+	}
+	if err := fn(v); err != nil {
+		if len(d.path) == 0 {
+			return err
+		}
+		return fmt.Errorf("%s: %w", strings.Join(d.path, "."), err)
+	}
+	return nil
+}
+
+func (d *Decoder) enter(key string) {
+	d.path = append(d.path, key)
+}
+
+func (d *Decoder) leave() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+func (d *Decoder) keyPath(key string) string {
+	if len(d.path) == 0 {
+		return key
+	}
+	return strings.Join(d.path, ".") + "." + key
+}
+
+func (d *Decoder) markUsed(key string, pos Position) {
+	d.report.use(d.keyPath(key), pos)
+}
+
+// markUnused records an unknown key in the report of the decoder. It returns an
+// error unless a report is requested, all the unknown keys should be reported
+// or this kind of key (option or table) is allowed to be unknown.
+func (d *Decoder) markUnused(key, what string, pos Position) error {
+	d.report.unuse(d.keyPath(key), pos)
+	if d.collect {
+		return nil
+	}
+	if (what == "option" && d.allowOpts) || (what == "table" && d.allowTabs) {
+		return nil
+	}
+	if d.unknown {
+		d.unknowns = append(d.unknowns, KeyPos{Key: d.keyPath(key), Pos: pos})
+		return nil
+	}
+	return fmt.Errorf("%s: %w %s", key, ErrUndefined, what)
+}
+
+// canceled gives the error of the context of the decoder once it is done.
+func (d *Decoder) canceled() error {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Err()
+}
+
+func (d *Decoder) decodeTable(t *Table, e reflect.Value) error {
+	if err := d.canceled(); err != nil {
+		return err
+	}
+	if e.Type() == orderedMapType {
+		m, err := d.decodeOrdered(t)
+		if err == nil {
+			e.Set(reflect.ValueOf(m).Elem())
+		}
+		return err
+	}
 	var err error
 	switch k := e.Kind(); k {
 	case reflect.Interface:
+		if !e.IsNil() {
+			err = d.decodeInterface(t, e)
+			break
+		}
+		if e.NumMethod() > 0 {
+			err = fmt.Errorf("table: can not decode into nil %s", e.Type())
+			break
+		}
 		var (
 			m  = make(map[string]interface{})
 			me = reflect.ValueOf(m)
 		)
-		err = decodeMap(t, me)
+		err = d.decodeMap(t, me)
 		if err == nil {
 			e.Set(me)
 		}
 	case reflect.Struct:
-		err = decodeStruct(t, e)
+		err = d.decodeStruct(t, e)
 	case reflect.Map:
-		err = decodeMap(t, e)
+		err = d.decodeMap(t, e)
 	case reflect.Ptr:
 		if e.IsNil() {
 			f := reflect.New(e.Type().Elem())
-			if err = decodeTable(t, reflect.Indirect(f)); err == nil {
+			if err = d.decodeTable(t, reflect.Indirect(f)); err == nil {
 				e.Set(f)
 			}
 		} else {
-			err = decodeTable(t, e.Elem())
+			err = d.decodeTable(t, e.Elem())
 		}
 	default:
 		err = fmt.Errorf("table: unexpected type %s", k)
@@ -84,97 +572,334 @@ func decodeTable(t *Table, e reflect.Value) error {
 	return err
 }
 
-func decodeArrayTable(t *Table, e reflect.Value) error {
-	if k := e.Kind(); !(k == reflect.Array || k == reflect.Slice) {
-		return fmt.Errorf("array: expected array/slice, got %s", k)
+// decodeInterface decodes t into the value already held by the interface e so
+// that the values it contains are kept when the document does not override
+// them.
+func (d *Decoder) decodeInterface(t *Table, e reflect.Value) error {
+	v := e.Elem()
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		return d.decodeTable(t, v)
+	case reflect.Struct:
+		x := reflect.New(v.Type()).Elem()
+		x.Set(v)
+		if err := d.decodeTable(t, x); err != nil {
+			return err
+		}
+		e.Set(x)
+		return nil
 	}
-	for _, n := range t.nodes {
+	if e.NumMethod() > 0 {
+		return fmt.Errorf("table: can not decode into %s", v.Type())
+	}
+	m := make(map[string]interface{})
+	if err := d.decodeMap(t, reflect.ValueOf(m)); err != nil {
+		return err
+	}
+	e.Set(reflect.ValueOf(m))
+	return nil
+}
+
+func (d *Decoder) decodeArrayTable(t *Table, e reflect.Value) error {
+	if err := checkArray(e, len(t.nodes)); err != nil {
+		return err
+	}
+	for i, n := range t.nodes {
 		x, ok := n.(*Table)
 		if !ok {
 			return fmt.Errorf("array: unexpected node type %T", n)
 		}
 		f := reflect.New(e.Type().Elem()).Elem()
-		if err := decodeTable(x, f); err != nil {
+		if err := d.decodeTable(x, f); err != nil {
 			return err
 		}
-		e.Set(reflect.Append(e, f))
+		if err := d.decoded(f); err != nil {
+			return err
+		}
+		setIndex(e, f, i)
 	}
 	return nil
 }
 
-func decodeArrayOption(a *Array, e reflect.Value) error {
+func (d *Decoder) decodeArrayOption(a *Array, e reflect.Value) error {
 	if isInterface(e.Kind()) {
 		var (
 			s = reflect.SliceOf(e.Type())
 			f = reflect.MakeSlice(s, 0, len(a.nodes))
 		)
 		f = reflect.New(f.Type()).Elem()
-		err := decodeArrayOption(a, f)
+		err := d.decodeArrayOption(a, f)
 		if err == nil {
 			e.Set(f)
 		}
 		return err
 	}
-	if k := e.Kind(); !(k == reflect.Array || k == reflect.Slice) {
-		return fmt.Errorf("array: expected array/slice, got %s", k)
+	if err := checkArray(e, len(a.nodes)); err != nil {
+		return err
 	}
 	var err error
-	for _, n := range a.nodes {
+	for i, n := range a.nodes {
 		f := reflect.New(e.Type().Elem()).Elem()
 		switch n := n.(type) {
 		case *Table:
-			err = decodeTable(n, f)
+			err = d.decodeTable(n, f)
 		case *Array:
-			err = decodeArrayOption(n, f)
+			err = d.decodeArrayOption(n, f)
 		case *Literal:
-			err = decodeLiteral(n, f)
+			err = d.decodeLiteral(n, f)
 		default:
 			err = fmt.Errorf("array: unexpected node type %T", n)
 		}
+		if err == nil {
+			err = d.decoded(f)
+		}
 		if err != nil {
 			break
 		}
-		e.Set(reflect.Append(e, f))
+		setIndex(e, f, i)
 	}
 	return err
 }
 
+// checkArray verifies that e can receive an array of size elements. Go arrays
+// should have exactly the same length as the TOML array.
+func checkArray(e reflect.Value, size int) error {
+	switch k := e.Kind(); k {
+	case reflect.Slice:
+		return nil
+	case reflect.Array:
+		if e.Len() != size {
+			return fmt.Errorf("array: length mismatched (want %d, got %d)", e.Len(), size)
+		}
+		return nil
+	default:
+		return fmt.Errorf("array: expected array/slice, got %s", k)
+	}
+}
+
+func setIndex(e, f reflect.Value, i int) {
+	if e.Kind() == reflect.Array {
+		e.Index(i).Set(f)
+		return
+	}
+	e.Set(reflect.Append(e, f))
+}
+
 type Setter interface {
 	Set(string) error
 }
 
 var setter = reflect.TypeOf((*Setter)(nil)).Elem()
 
-func decodeOption(o *Option, e reflect.Value) error {
+// Unmarshaler is implemented by types that can decode a TOML value themselves.
+// UnmarshalTOML receives the value as it would be decoded into an empty
+// interface: string, int64, float64, bool, time.Time, []interface{} or
+// map[string]interface{}.
+type Unmarshaler interface {
+	UnmarshalTOML(interface{}) error
+}
+
+var unmarshaler = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+// unmarshalerOf gives the Unmarshaler implemented by e or by a pointer to e. A
+// nil pointer implementing Unmarshaler is allocated first.
+func unmarshalerOf(e reflect.Value) (Unmarshaler, bool) {
+	if e.CanAddr() {
+		if a := e.Addr(); a.CanInterface() && a.Type().Implements(unmarshaler) {
+			return a.Interface().(Unmarshaler), true
+		}
+	}
+	if !e.CanInterface() || !e.Type().Implements(unmarshaler) {
+		return nil, false
+	}
+	if e.Kind() == reflect.Ptr && e.IsNil() {
+		if !e.CanSet() {
+			return nil, false
+		}
+		e.Set(reflect.New(e.Type().Elem()))
+	}
+	return e.Interface().(Unmarshaler), true
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// textUnmarshalerOf gives the encoding.TextUnmarshaler implemented by a pointer
+// to e. Values of e that are not addressable can not be modified and are
+// ignored.
+func textUnmarshalerOf(e reflect.Value) (encoding.TextUnmarshaler, bool) {
+	if !e.CanAddr() {
+		return nil, false
+	}
+	a := e.Addr()
+	if !a.CanInterface() || !a.Type().Implements(textUnmarshaler) {
+		return nil, false
+	}
+	return a.Interface().(encoding.TextUnmarshaler), true
+}
+
+// unmarshal decodes n into an empty interface and gives the result to u.
+func (d *Decoder) unmarshal(n Node, u Unmarshaler) error {
+	var v interface{}
+	if err := d.decodeValue(n, reflect.ValueOf(&v).Elem()); err != nil {
+		return err
+	}
+	return u.UnmarshalTOML(v)
+}
+
+func (d *Decoder) decodeOption(o *Option, e reflect.Value) error {
+	if err := d.canceled(); err != nil {
+		return err
+	}
+	if _, ok := o.value.(*Table); !ok && d.skipEmpty && !isEmptyValue(e) {
+		v := reflect.New(e.Type()).Elem()
+		if err := d.decodeValue(o.value, v); err != nil {
+			return d.optionError(o, err)
+		}
+		if isEmptyValue(v) {
+			return nil
+		}
+		e.Set(v)
+		return d.decoded(e)
+	}
+	if err := d.decodeValue(o.value, e); err != nil {
+		return d.optionError(o, err)
+	}
+	return d.decoded(e)
+}
+
+// optionError wraps err into a DecodeError giving the key and the position of
+// o unless err already comes from a nested option.
+func (d *Decoder) optionError(o *Option, err error) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return err
+	}
+	return &DecodeError{
+		Key: strings.Join(d.path, "."),
+		Pos: o.Pos(),
+		Err: err,
+	}
+}
+
+// decodeSplit splits the string value of o on sep and decodes each part,
+// without the surrounding spaces, into an element of the slice e. Other values
+// and slices implementing Unmarshaler are decoded as usual. Like decodeOption,
+// an empty string does not replace a non empty slice when empty values are
+// skipped.
+func (d *Decoder) decodeSplit(o *Option, e reflect.Value, sep string) error {
+	i, ok := o.value.(*Literal)
+	if !ok || !i.token.IsString() || e.Kind() != reflect.Slice || sep == "" {
+		return d.decodeOption(o, e)
+	}
+	if _, ok := unmarshalerOf(e); ok {
+		return d.decodeOption(o, e)
+	}
+	if err := d.canceled(); err != nil {
+		return err
+	}
+	var parts []string
+	if strings.TrimSpace(i.token.Literal) != "" {
+		parts = strings.Split(i.token.Literal, sep)
+	}
+	vs := reflect.MakeSlice(e.Type(), 0, len(parts))
+	for _, str := range parts {
+		var (
+			f   = reflect.New(e.Type().Elem()).Elem()
+			err error
+		)
+		str = strings.TrimSpace(str)
+		_, text := textUnmarshalerOf(f)
+		switch k := f.Kind(); {
+		case isString(k) || text:
+			err = decodeString(f, str)
+		case isInt(k) || isUint(k):
+			err = decodeInt(f, str)
+		case isFloat(k):
+			err = decodeFloat(f, str)
+		case isBool(k):
+			err = decodeBool(f, str)
+		default:
+			err = fmt.Errorf("split: unsupported type %s", f.Type())
+		}
+		if err != nil {
+			return &DecodeError{
+				Key: strings.Join(d.path, "."),
+				Pos: i.Pos(),
+				Err: err,
+			}
+		}
+		vs = reflect.Append(vs, f)
+	}
+	if d.skipEmpty && !isEmptyValue(e) && isEmptyValue(vs) {
+		return nil
+	}
+	e.Set(vs)
+	return d.decoded(e)
+}
+
+func (d *Decoder) decodeValue(n Node, e reflect.Value) error {
+	if e.Type() == typedValueType {
+		return d.decodeTyped(n, e)
+	}
+	if u, ok := unmarshalerOf(e); ok {
+		return d.unmarshal(n, u)
+	}
 	var err error
-	switch n := o.value.(type) {
+	switch n := n.(type) {
 	case *Array:
-		err = decodeArrayOption(n, e)
+		err = d.decodeArrayOption(n, e)
 	case *Table:
-		err = decodeTable(n, e)
+		err = d.decodeTable(n, e)
 	case *Literal:
 		if e.CanInterface() && e.Type().Implements(setter) {
-			return e.Interface().(Setter).Set(n.token.Literal)
+			err = e.Interface().(Setter).Set(n.token.Literal)
+			break
 		}
 		if e.CanAddr() {
 			a := e.Addr()
 			if a.CanInterface() && a.Type().Implements(setter) {
-				return a.Interface().(Setter).Set(n.token.Literal)
+				err = a.Interface().(Setter).Set(n.token.Literal)
+				break
 			}
 		}
-		err = decodeLiteral(n, e)
+		err = d.decodeLiteral(n, e)
 	default:
 		err = fmt.Errorf("option: unexpected node type %T", n)
 	}
 	return err
 }
 
-func decodeLiteral(i *Literal, e reflect.Value) error {
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+var numberType = reflect.TypeOf(Number(""))
+
+func (d *Decoder) decodeLiteral(i *Literal, e reflect.Value) error {
+	if u, ok := unmarshalerOf(e); ok {
+		return d.unmarshal(i, u)
+	}
+	if i.token.IsNumber() && d.isNumber(e) {
+		e.Set(reflect.ValueOf(Number(i.token.Raw)))
+		return nil
+	}
 	var err error
 	switch str := i.token.Literal; i.token.Type {
 	default:
 		err = fmt.Errorf("literal: unexpected token type: %s", i.token)
 	case TokBasic, TokLiteral, TokBasicMulti, TokLiteralMulti:
+		if vs, ok := d.funcs[e.Type()]; ok {
+			err = d.decodeFunc(e, str, vs)
+			break
+		}
 		err = decodeString(e, str)
 	case TokBool:
 		err = decodeBool(e, str)
@@ -183,13 +908,65 @@ func decodeLiteral(i *Literal, e reflect.Value) error {
 	case TokFloat:
 		err = decodeFloat(e, str)
 	case TokDatetime:
+		if e.Type() == dateTimeType {
+			err = decodeDateTime(e, str)
+			break
+		}
 		err = decodeTime(e, str, makeAllPatterns())
 	case TokDate:
+		if e.Type() == dateType {
+			err = decodeDate(e, str)
+			break
+		}
 		err = decodeTime(e, str, []string{dateFormat})
 	case TokTime:
-		err = decodeTime(e, str, makeTimePatterns())
+		switch e.Type() {
+		case durationType:
+			err = decodeSinceMidnight(e, str)
+		case timeOfDayType:
+			err = decodeTimeOfDay(e, str)
+		default:
+			err = decodeTime(e, str, makeTimePatterns())
+		}
 	}
-	return err
+	if err != nil {
+		return &DecodeError{
+			Key: strings.Join(d.path, "."),
+			Pos: i.Pos(),
+			Err: err,
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) isNumber(e reflect.Value) bool {
+	if e.Type() == numberType {
+		return true
+	}
+	return d.useNumber && isInterface(e.Kind()) && e.NumMethod() == 0
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeSinceMidnight decodes a local time into the duration elapsed since
+// 00:00:00.
+func decodeSinceMidnight(e reflect.Value, str string) error {
+	var (
+		v   = reflect.New(timeType).Elem()
+		err = decodeTime(v, str, makeTimePatterns())
+	)
+	if err != nil {
+		return err
+	}
+	var (
+		when  = v.Interface().(time.Time)
+		since = time.Duration(when.Hour())*time.Hour +
+			time.Duration(when.Minute())*time.Minute +
+			time.Duration(when.Second())*time.Second +
+			time.Duration(when.Nanosecond())
+	)
+	e.SetInt(int64(since))
+	return nil
 }
 
 func decodeTime(e reflect.Value, str string, patterns []string) error {
@@ -221,10 +998,13 @@ func decodeTime(e reflect.Value, str string, patterns []string) error {
 func decodeFloat(e reflect.Value, str string) error {
 	str = strings.ReplaceAll(str, "_", "")
 
-	val, err := strconv.ParseFloat(str, 64)
+	val, err := parseFloat(str)
 	if err != nil {
 		return err
 	}
+	if k := e.Kind(); (isInt(k) || isUint(k)) && isNonFinite(val) {
+		return fmt.Errorf("float(%s): non finite number to %s", str, k)
+	}
 	switch k := e.Kind(); {
 	case isString(k):
 		e.SetString(str)
@@ -257,6 +1037,9 @@ func decodeFloat(e reflect.Value, str string) error {
 
 func decodeInt(e reflect.Value, str string) error {
 	str = strings.ReplaceAll(str, "_", "")
+	if isUint(e.Kind()) {
+		return decodeUint(e, str)
+	}
 
 	val, err := strconv.ParseInt(str, 0, 64)
 	if err != nil {
@@ -270,11 +1053,6 @@ func decodeInt(e reflect.Value, str string) error {
 			break
 		}
 		e.SetInt(val)
-	case isUint(k):
-		if err = checkUintRange(k, uint64(val)); err != nil {
-			break
-		}
-		e.SetUint(uint64(val))
 	case isFloat(k):
 		if err = checkFloatRange(k, float64(val)); err != nil {
 			break
@@ -288,6 +1066,24 @@ func decodeInt(e reflect.Value, str string) error {
 	return err
 }
 
+// decodeUint parses str as an unsigned integer so that values greater than
+// math.MaxInt64 can be decoded into uint64.
+func decodeUint(e reflect.Value, str string) error {
+	str = strings.TrimPrefix(str, "+")
+	if strings.HasPrefix(str, "-") && strings.Trim(str[1:], "0") != "" {
+		return fmt.Errorf("int(%s): negative number to unsigned", str)
+	}
+	val, err := strconv.ParseUint(strings.TrimPrefix(str, "-"), 0, 64)
+	if err != nil {
+		return err
+	}
+	if err := checkUintRange(e.Kind(), val); err != nil {
+		return err
+	}
+	e.SetUint(val)
+	return nil
+}
+
 func decodeBool(e reflect.Value, str string) error {
 	val, err := strconv.ParseBool(str)
 	if err != nil {
@@ -307,6 +1103,17 @@ func decodeBool(e reflect.Value, str string) error {
 }
 
 func decodeString(e reflect.Value, str string) error {
+	if u, ok := textUnmarshalerOf(e); ok {
+		return u.UnmarshalText([]byte(str))
+	}
+	if e.Type() == durationType {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("duration(%s): %w", str, err)
+		}
+		e.SetInt(int64(d))
+		return nil
+	}
 	var err error
 	switch k := e.Kind(); {
 	case isString(k):
@@ -321,7 +1128,7 @@ func decodeString(e reflect.Value, str string) error {
 	return err
 }
 
-func decodeMap(t *Table, e reflect.Value) error {
+func (d *Decoder) decodeMap(t *Table, e reflect.Value) error {
 	key := e.Type().Key()
 	if k := key.Kind(); !isString(k) {
 		return fmt.Errorf("map: key should be of type string")
@@ -339,56 +1146,84 @@ func decodeMap(t *Table, e reflect.Value) error {
 		switch n := n.(type) {
 		case *Table:
 			k = n.key.Literal
-			if n.kind == tableArray {
-				var (
-					vs = make([]interface{}, 0, len(n.nodes))
-					m  = reflect.MakeSlice(reflect.TypeOf(vs), 0, len(n.nodes))
-				)
-				f = reflect.New(m.Type()).Elem()
-				err = decodeArrayTable(n, f)
-			} else {
-				f = reflect.MakeMap(e.Type())
-				err = decodeMap(n, f)
+			d.markUsed(k, n.Pos())
+			d.enter(k)
+			f = reflect.New(e.Type().Elem()).Elem()
+			switch {
+			case n.kind == tableArray && isInterface(f.Kind()):
+				vs := reflect.New(reflect.SliceOf(f.Type())).Elem()
+				if err = d.decodeArrayTable(n, vs); err == nil {
+					f.Set(vs)
+				}
+			case n.kind == tableArray:
+				err = d.decodeArrayTable(n, f)
+			default:
+				err = d.decodeTable(n, f)
+			}
+			if err == nil {
+				err = d.decoded(f)
 			}
+			d.leave()
 		case *Option:
 			f, k = reflect.New(e.Type().Elem()).Elem(), n.key.Literal
-			err = decodeOption(n, f)
+			d.markUsed(k, n.Pos())
+			d.enter(k)
+			err = d.decodeOption(n, f)
+			d.leave()
 		default:
 			err = fmt.Errorf("map: unexpected node type %T", n)
 		}
 		if err != nil {
 			break
 		}
-		e.SetMapIndex(reflect.ValueOf(k), f)
+		e.SetMapIndex(reflect.ValueOf(k).Convert(key), f)
 	}
 	return err
 }
 
-func decodeStruct(t *Table, e reflect.Value) error {
+func (d *Decoder) decodeStruct(t *Table, e reflect.Value) error {
 	var (
 		err    error
-		fields = getFields(e)
+		fields = structFields{
+			value:  e,
+			byName: getFields(e),
+		}
 	)
 	for _, n := range t.nodes {
 		switch n := n.(type) {
 		case *Option:
-			f, ok := fields[n.key.Literal]
+			f, ok := d.lookupField(&fields, n.key.Literal)
 			if !ok {
-				err = fmt.Errorf("%s: %w option", n.key.Literal, ErrUndefined)
+				err = d.markUnused(n.key.Literal, "option", n.Pos())
 				break
 			}
-			err = decodeOption(n, f)
+			d.markUsed(n.key.Literal, n.Pos())
+			d.enter(n.key.Literal)
+			if sep, ok := f.tag.value("split"); ok {
+				err = d.decodeSplit(n, f.value, sep)
+			} else {
+				err = d.decodeOption(n, f.value)
+			}
+			d.leave()
 		case *Table:
-			f, ok := fields[n.key.Literal]
+			f, ok := d.lookupField(&fields, n.key.Literal)
 			if !ok {
-				err = fmt.Errorf("%s: %w table", n.key.Literal, ErrUndefined)
+				err = d.markUnused(n.key.Literal, "table", n.Pos())
 				break
 			}
-			if n.kind == tableArray {
-				err = decodeArrayTable(n, f)
+			d.markUsed(n.key.Literal, n.Pos())
+			d.enter(n.key.Literal)
+			if f.tag.has("raw") {
+				err = decodeRaw(n, f.value)
+			} else if n.kind == tableArray {
+				err = d.decodeArrayTable(n, f.value)
 			} else {
-				err = decodeTable(n, f)
+				err = d.decodeTable(n, f.value)
+			}
+			if err == nil {
+				err = d.decoded(f.value)
 			}
+			d.leave()
 		default:
 			err = fmt.Errorf("table: unexpected node type %T", n)
 		}
@@ -399,8 +1234,103 @@ func decodeStruct(t *Table, e reflect.Value) error {
 	return err
 }
 
-func getFields(v reflect.Value) map[string]reflect.Value {
-	fs := make(map[string]reflect.Value)
+// decodeRaw writes the source of t (without its header) into e. The sources
+// of the tables of an array of tables are written into a slice of strings.
+// Tables without a header of their own (implicit tables and tables defined
+// by dotted keys) have no source and are rejected.
+func decodeRaw(t *Table, e reflect.Value) error {
+	switch k := e.Kind(); {
+	case isString(k) && t.kind != tableArray:
+		if !t.hasSource() {
+			return fmt.Errorf("raw: %s table has no source", t.key.Literal)
+		}
+		e.SetString(t.raw)
+	case k == reflect.Slice && isString(e.Type().Elem().Kind()) && t.kind == tableArray:
+		vs := reflect.MakeSlice(e.Type(), 0, len(t.nodes))
+		for _, n := range t.nodes {
+			if x, ok := n.(*Table); ok {
+				vs = reflect.Append(vs, reflect.ValueOf(x.raw).Convert(e.Type().Elem()))
+			}
+		}
+		e.Set(vs)
+	default:
+		return fmt.Errorf("raw: unsupported type %s", e.Type())
+	}
+	return nil
+}
+
+// structFields gives the fields of the struct value by name (or tag) and, for
+// MatchKey, in their declaration order. The ordered list is only computed once
+// it is needed.
+type structFields struct {
+	value  reflect.Value
+	byName map[string]structField
+	list   []structField
+}
+
+func (fs *structFields) ordered() []structField {
+	if fs.list == nil {
+		fs.list = listFields(fs.value)
+	}
+	return fs.list
+}
+
+// lookupField gives the field of the struct that receives the value of key. The
+// resolver registered with SetFieldResolver is tried first, then the names (or
+// tags) of the fields and finally the function registered with MatchKey.
+func (d *Decoder) lookupField(fs *structFields, key string) (structField, bool) {
+	e := fs.value
+	if d.resolve != nil {
+		if name, ok := d.resolve(e.Type(), key); ok {
+			sf, ok := e.Type().FieldByName(name)
+			if !ok {
+				return structField{}, false
+			}
+			v, ok := fieldByIndex(e, sf.Index)
+			if !ok {
+				return structField{}, false
+			}
+			f := structField{
+				name:  name,
+				tag:   parseTag(sf.Tag.Get("toml")),
+				value: v,
+			}
+			return f, f.value.CanSet()
+		}
+	}
+	f, ok := fs.byName[key]
+	if ok || d.match == nil {
+		return f, ok
+	}
+	for _, f := range fs.ordered() {
+		if d.match(f.field, key) && f.value.CanSet() {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates the nil
+// pointers to embedded structs found on the way instead of panicking. It fails
+// if such a pointer can not be set.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func getFields(v reflect.Value) map[string]structField {
+	fs := make(map[string]structField)
 	if v.Kind() != reflect.Struct {
 		return fs
 	}
@@ -412,27 +1342,83 @@ func getFields(v reflect.Value) map[string]reflect.Value {
 		}
 		var (
 			tf  = typ.Field(i)
-			tag string
+			tag = parseTag(tf.Tag.Get("toml"))
 		)
-		if tf.Anonymous && tf.Tag.Get("toml") == "" {
-			ms := getFields(f)
+		if tf.Anonymous && tag.name == "" {
+			ms := getFields(reflect.Indirect(f))
 			for k, v := range ms {
 				fs[k] = v
 			}
+			if k := strings.ToLower(tf.Name); !fs[k].value.IsValid() {
+				fs[k] = structField{name: k, value: f}
+			}
 			continue
 		}
-		switch tag = tf.Tag.Get("toml"); tag {
-		case "-":
+		if tag.skip() {
 			continue
-		case "":
-			tag = strings.ToLower(tf.Name)
-		default:
 		}
-		fs[tag] = f
+		if tag.name == "" {
+			tag.name = strings.ToLower(tf.Name)
+		}
+		fs[tag.name] = structField{
+			name:  tag.name,
+			tag:   tag,
+			value: f,
+		}
 	}
 	return fs
 }
 
+// fieldTag holds the name and the options given in the toml tag of a field
+// (eg: `toml:"name,opt1,opt2"`).
+type fieldTag struct {
+	name    string
+	options []string
+}
+
+// parseTag splits tag on commas. The option split (eg: split=,) takes the rest
+// of the tag as its value since its separator can be a comma.
+func parseTag(tag string) fieldTag {
+	parts := strings.Split(tag, ",")
+	f := fieldTag{
+		name: strings.TrimSpace(parts[0]),
+	}
+	for i := 1; i < len(parts); i++ {
+		if strings.HasPrefix(strings.TrimSpace(parts[i]), "split=") {
+			f.options = append(f.options, strings.Join(parts[i:], ","))
+			break
+		}
+		f.options = append(f.options, parts[i])
+	}
+	return f
+}
+
+// value gives the value of an option written as opt=value.
+func (f fieldTag) value(opt string) (string, bool) {
+	for _, o := range f.options {
+		o = strings.TrimLeft(o, " ")
+		if strings.HasPrefix(o, opt+"=") {
+			return o[len(opt)+1:], true
+		}
+	}
+	return "", false
+}
+
+// skip tells if the field should be ignored. Like in encoding/json, only the
+// tag "-" ignores a field: "-," gives the field the key "-".
+func (f fieldTag) skip() bool {
+	return f.name == "-" && len(f.options) == 0
+}
+
+func (f fieldTag) has(opt string) bool {
+	for _, o := range f.options {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+	return false
+}
+
 func isString(k reflect.Kind) bool {
 	return k == reflect.String
 }
@@ -467,6 +1453,10 @@ func checkIntRange(k reflect.Kind, val int64) error {
 	return err
 }
 
+func isInteger(k reflect.Kind) bool {
+	return isInt(k) || isUint(k)
+}
+
 func isUint(k reflect.Kind) bool {
 	return k == reflect.Uint || k == reflect.Uint8 || k == reflect.Uint16 ||
 		k == reflect.Uint32 || k == reflect.Uint64
@@ -502,6 +1492,9 @@ func checkFloatRange(k reflect.Kind, val float64) error {
 		ok  bool
 		err error
 	)
+	if isNonFinite(val) {
+		return nil
+	}
 	switch k {
 	case reflect.Float32:
 		ok = val >= -math.MaxFloat32 && val <= math.MaxFloat32
@@ -514,6 +1507,21 @@ func checkFloatRange(k reflect.Kind, val float64) error {
 	return err
 }
 
+// parseFloat parses str like strconv.ParseFloat but also accepts the signed
+// nan of TOML (+nan and -nan) that ParseFloat rejects.
+func parseFloat(str string) (float64, error) {
+	switch str {
+	case "+nan", "-nan":
+		return math.NaN(), nil
+	default:
+		return strconv.ParseFloat(str, 64)
+	}
+}
+
+func isNonFinite(val float64) bool {
+	return math.IsNaN(val) || math.IsInf(val, 0)
+}
+
 func isInterface(k reflect.Kind) bool {
 	return k == reflect.Interface
 }
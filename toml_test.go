@@ -1,6 +1,15 @@
 package toml
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -167,3 +176,1750 @@ func testDecodePointers(t *testing.T) {
 func decodeFile(p interface{}) error {
 	return DecodeFile("testdata/package.toml", p)
 }
+
+func TestDecodeReport(t *testing.T) {
+	const sample = `
+name    = "toml"
+version = "1.0.0"
+license = "MIT"
+
+[dev]
+name  = "midbel"
+email = "noreply@midbel.org"
+site  = "https://github.com/midbel"
+`
+	var (
+		d   = NewDecoder(strings.NewReader(sample))
+		dev = struct {
+			Name    string
+			Version string
+			Dev     struct {
+				Name  string
+				Email string
+			}
+		}{}
+	)
+	rpt, err := d.DecodeReport(&dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := []KeyPos{
+		{Key: "name", Pos: Position{Line: 2, Column: 1}},
+		{Key: "version", Pos: Position{Line: 3, Column: 1}},
+		{Key: "dev", Pos: Position{Line: 6, Column: 2}},
+		{Key: "dev.name", Pos: Position{Line: 7, Column: 1}},
+		{Key: "dev.email", Pos: Position{Line: 8, Column: 1}},
+	}
+	unused := []KeyPos{
+		{Key: "license", Pos: Position{Line: 4, Column: 1}},
+		{Key: "dev.site", Pos: Position{Line: 9, Column: 1}},
+	}
+	if !reflect.DeepEqual(rpt.Used, used) {
+		t.Errorf("used keys mismatched: want %v, got %v", used, rpt.Used)
+	}
+	if !reflect.DeepEqual(rpt.Unused, unused) {
+		t.Errorf("unused keys mismatched: want %v, got %v", unused, rpt.Unused)
+	}
+	if dev.Name != "toml" || dev.Dev.Email != "noreply@midbel.org" {
+		t.Errorf("values not decoded properly: %+v", dev)
+	}
+}
+
+func TestDecodeDisallowUnknownFields(t *testing.T) {
+	const sample = `
+name    = "toml"
+licence = "MIT"
+
+[dev]
+name  = "midbel"
+emial = "noreply@midbel.org"
+
+[[projects]]
+name = "glob"
+`
+	var (
+		d   = NewDecoder(strings.NewReader(sample))
+		dev = struct {
+			Name string
+			Dev  struct {
+				Name  string
+				Email string
+			}
+		}{}
+	)
+	d.DisallowUnknownFields()
+	err := d.Decode(&dev)
+	if !errors.Is(err, ErrUndefined) {
+		t.Fatalf("unknown keys not reported: %v", err)
+	}
+	var uke *UnknownKeysError
+	if !errors.As(err, &uke) {
+		t.Fatalf("unexpected error type %T", err)
+	}
+	want := []KeyPos{
+		{Key: "licence", Pos: Position{Line: 3, Column: 1}},
+		{Key: "dev.emial", Pos: Position{Line: 7, Column: 1}},
+		{Key: "projects", Pos: Position{Line: 9, Column: 3}},
+	}
+	if !reflect.DeepEqual(uke.Keys, want) {
+		t.Errorf("unknown keys mismatched: want %v, got %v", want, uke.Keys)
+	}
+	if str := err.Error(); !strings.Contains(str, "7:1 dev.emial") {
+		t.Errorf("position not found in error: %s", str)
+	}
+}
+
+func TestDecodeAllowUnknown(t *testing.T) {
+	const sample = `
+name    = "toml"
+licence = "MIT"
+
+[dev]
+name  = "midbel"
+emial = "noreply@midbel.org"
+
+[devs]
+name = "midbel"
+`
+	type Config struct {
+		Name string
+		Dev  struct {
+			Name  string
+			Email string
+		}
+	}
+	var c Config
+	d := NewDecoder(strings.NewReader(sample))
+	d.SetAllowUnknownOptions(true)
+	err := d.Decode(&c)
+	if err == nil || !strings.HasPrefix(err.Error(), "devs: ") {
+		t.Errorf("unknown table not reported: %v", err)
+	}
+
+	c = Config{}
+	d = NewDecoder(strings.NewReader(sample))
+	d.SetAllowUnknownOptions(true)
+	d.SetAllowUnknownTables(true)
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "toml" || c.Dev.Name != "midbel" {
+		t.Errorf("values not decoded properly: %+v", c)
+	}
+
+	d = NewDecoder(strings.NewReader(sample))
+	d.SetAllowUnknownTables(true)
+	d.DisallowUnknownFields()
+	err = d.Decode(&c)
+	var uke *UnknownKeysError
+	if !errors.As(err, &uke) {
+		t.Fatalf("unknown options not reported: %v", err)
+	}
+	if len(uke.Keys) != 2 || uke.Keys[0].Key != "licence" || uke.Keys[1].Key != "dev.emial" {
+		t.Errorf("unknown keys mismatched: %v", uke.Keys)
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	const sample = `
+name    = "toml"
+licence = "MIT"
+
+[dev]
+name  = "midbel"
+emial = "noreply@midbel.org"
+
+[[plugins]]
+name = "lint"
+
+[[plugins]]
+name = "fmt"
+
+[devs]
+name = "midbel"
+`
+	type Config struct {
+		Name string
+		Dev  struct {
+			Name  string
+			Email string
+		}
+		Plugins []struct {
+			Name string
+		}
+	}
+	var c Config
+	d := NewDecoder(strings.NewReader(sample))
+	d.SetAllowUnknownOptions(true)
+	d.SetAllowUnknownTables(true)
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		meta      = d.Metadata()
+		keys      = []string{"name", "licence", "dev", "dev.name", "dev.emial", "plugins", "plugins.name", "devs"}
+		undecoded = []string{"licence", "dev.emial", "devs"}
+	)
+	if got := meta.Keys(); !reflect.DeepEqual(got, keys) {
+		t.Errorf("keys mismatched: want %q, got %q", keys, got)
+	}
+	if got := meta.Undecoded(); !reflect.DeepEqual(got, undecoded) {
+		t.Errorf("undecoded keys mismatched: want %q, got %q", undecoded, got)
+	}
+}
+
+func TestDecodeMixedNumbers(t *testing.T) {
+	const sample = "values = [1, 2.0, 3]\n"
+
+	check := func(t *testing.T, vs []interface{}) {
+		t.Helper()
+		want := []interface{}{int64(1), float64(2), int64(3)}
+		if !reflect.DeepEqual(vs, want) {
+			t.Errorf("array mismatched: want %#v, got %#v", want, vs)
+		}
+	}
+	t.Run("slice", func(t *testing.T) {
+		c := struct {
+			Values []interface{}
+		}{}
+		if err := Decode(strings.NewReader(sample), &c); err != nil {
+			t.Fatal(err)
+		}
+		check(t, c.Values)
+	})
+	t.Run("interface", func(t *testing.T) {
+		c := make(map[string]interface{})
+		if err := Decode(strings.NewReader(sample), &c); err != nil {
+			t.Fatal(err)
+		}
+		vs, ok := c["values"].([]interface{})
+		if !ok {
+			t.Fatalf("unexpected type %T", c["values"])
+		}
+		check(t, vs)
+	})
+}
+
+func TestDecodeEmpty(t *testing.T) {
+	docs := []string{
+		"",
+		"   \t",
+		"\n\n\n",
+		"# comment",
+		"# header\n# comment\n\n",
+		"\n  # indented comment\n\n",
+	}
+	for _, doc := range docs {
+		var c struct {
+			Name    string
+			Version int
+			Dev     *Dev
+		}
+		if err := Decode(strings.NewReader(doc), &c); err != nil {
+			t.Errorf("%q: unexpected error: %s", doc, err)
+			continue
+		}
+		if c.Name != "" || c.Version != 0 || c.Dev != nil {
+			t.Errorf("%q: fields should be left to their zero values: %+v", doc, c)
+		}
+	}
+}
+
+func TestDecodeEmptyReader(t *testing.T) {
+	var (
+		m interface{}
+		d = make(map[string]interface{})
+	)
+	if err := Decode(strings.NewReader(""), &m); err != nil {
+		t.Fatalf("interface: unexpected error: %s", err)
+	}
+	if vs, ok := m.(map[string]interface{}); !ok || len(vs) != 0 {
+		t.Errorf("interface: expected empty map, got %#v", m)
+	}
+	if err := Decode(strings.NewReader(""), &d); err != nil {
+		t.Fatalf("map: unexpected error: %s", err)
+	}
+	if len(d) != 0 {
+		t.Errorf("map: expected empty map, got %#v", d)
+	}
+}
+
+func TestDecodeNumber(t *testing.T) {
+	const sample = `
+integer = 1_000
+hexa    = 0xdead_beef
+octal   = 0o755
+binary  = 0b11
+float   = +3.14_15
+expo    = 1e6
+inf     = -inf
+nan     = nan
+`
+	data := []struct {
+		Key   string
+		Want  Number
+		Base  int
+		Float bool
+	}{
+		{Key: "integer", Want: "1_000", Base: 10},
+		{Key: "hexa", Want: "0xdead_beef", Base: 16},
+		{Key: "octal", Want: "0o755", Base: 8},
+		{Key: "binary", Want: "0b11", Base: 2},
+		{Key: "float", Want: "+3.14_15", Base: 10, Float: true},
+		{Key: "expo", Want: "1e6", Base: 10, Float: true},
+		{Key: "inf", Want: "-inf", Base: 10, Float: true},
+		{Key: "nan", Want: "nan", Base: 10, Float: true},
+	}
+	var (
+		m = make(map[string]interface{})
+		d = NewDecoder(strings.NewReader(sample))
+	)
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range data {
+		got, ok := m[d.Key].(Number)
+		if !ok {
+			t.Errorf("%s: expected Number, got %T", d.Key, m[d.Key])
+			continue
+		}
+		if got != d.Want {
+			t.Errorf("%s: number mismatched: want %s, got %s", d.Key, d.Want, got)
+		}
+		if got.Base() != d.Base {
+			t.Errorf("%s: base mismatched: want %d, got %d", d.Key, d.Base, got.Base())
+		}
+		if got.IsFloat() != d.Float || got.IsInt() == d.Float {
+			t.Errorf("%s: wrong number type detected", d.Key)
+		}
+	}
+	c := struct {
+		Hexa Number
+	}{}
+	if err := Decode(strings.NewReader("hexa = 0xff"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := c.Hexa.Int64(); c.Hexa != "0xff" || v != 255 {
+		t.Errorf("number field not decoded properly: %s (%d)", c.Hexa, v)
+	}
+}
+
+func TestDecodeArrayOfStructs(t *testing.T) {
+	type Endpoint struct {
+		Addr string
+		Port int
+	}
+	const sample = `
+endpoints = [
+	{addr = "10.0.0.1", port = 80},
+	{addr = "10.0.0.2", port = 443},
+]
+`
+	c := struct {
+		Endpoints [2]Endpoint
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := [2]Endpoint{
+		{Addr: "10.0.0.1", Port: 80},
+		{Addr: "10.0.0.2", Port: 443},
+	}
+	if c.Endpoints != want {
+		t.Errorf("endpoints mismatched: want %v, got %v", want, c.Endpoints)
+	}
+
+	invalid := struct {
+		Endpoints [3]Endpoint
+	}{}
+	if err := Decode(strings.NewReader(sample), &invalid); err == nil {
+		t.Errorf("length mismatched not detected")
+	}
+}
+
+func TestDecodeFixedArrays(t *testing.T) {
+	const sample = `
+color  = [1.0, 0.5, 0.25]
+matrix = [[1, 2, 3], [4, 5, 6]]
+
+[[point]]
+x = 1
+
+[[point]]
+x = 2
+`
+	type Point struct {
+		X int
+	}
+	c := struct {
+		Color  [3]float64
+		Matrix [2][3]int
+		Point  [2]Point
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Color != [3]float64{1, 0.5, 0.25} {
+		t.Errorf("color mismatched: %v", c.Color)
+	}
+	if c.Matrix != [2][3]int{{1, 2, 3}, {4, 5, 6}} {
+		t.Errorf("matrix mismatched: %v", c.Matrix)
+	}
+	if c.Point != [2]Point{{X: 1}, {X: 2}} {
+		t.Errorf("points mismatched: %v", c.Point)
+	}
+
+	data := []string{
+		"color = [1.0, 0.5]",
+		"color = [1.0, 0.5, 0.25, 0.0]",
+		"matrix = [[1, 2], [4, 5, 6]]",
+		"[[point]]\nx = 1",
+	}
+	for _, str := range data {
+		var c struct {
+			Color  [3]float64
+			Matrix [2][3]int
+			Point  [2]Point
+		}
+		err := Decode(strings.NewReader(str), &c)
+		if err == nil || !strings.Contains(err.Error(), "length mismatched") {
+			t.Errorf("%q: length mismatched not detected (%v)", str, err)
+		}
+	}
+}
+
+func TestDecodeHook(t *testing.T) {
+	const sample = `
+name = "pool"
+
+[[dependency]]
+repository = "https://github.com/midbel/glob"
+version    = "0.1.1"
+
+[[dependency]]
+repository = "https://github.com/midbel/maestro"
+version    = "0.1.0"
+
+[dev]
+name = "midbel"
+`
+	var (
+		deps []string
+		devs int
+	)
+	c := struct {
+		Name string
+		Deps []Dependency `toml:"dependency"`
+		Dev  *Dev
+	}{}
+	d := NewDecoder(strings.NewReader(sample))
+	d.OnDecode(reflect.TypeOf(Dependency{}), func(v interface{}) error {
+		dep := v.(*Dependency)
+		deps = append(deps, dep.Repository)
+		dep.Version = "v" + dep.Version
+		return nil
+	})
+	d.OnDecode(reflect.TypeOf(&Dev{}), func(v interface{}) error {
+		devs++
+		return nil
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if len(deps) != 2 || deps[0] != c.Deps[0].Repository || deps[1] != c.Deps[1].Repository {
+		t.Errorf("hook not called for each dependency: %v", deps)
+	}
+	if c.Deps[0].Version != "v0.1.1" || c.Deps[1].Version != "v0.1.0" {
+		t.Errorf("hook changes not kept: %+v", c.Deps)
+	}
+	if devs != 1 {
+		t.Errorf("hook called %d times for dev (want 1)", devs)
+	}
+
+	d = NewDecoder(strings.NewReader(sample))
+	d.OnDecode(reflect.TypeOf(""), func(v interface{}) error {
+		if *v.(*string) == "midbel" {
+			return fmt.Errorf("invalid name")
+		}
+		return nil
+	})
+	if err := d.Decode(&c); err == nil {
+		t.Errorf("error returned by hook not reported")
+	}
+}
+
+type Step interface {
+	Run(string) string
+}
+
+type upperStep struct{}
+
+func (upperStep) Run(str string) string {
+	return strings.ToUpper(str)
+}
+
+func TestDecodeRegisterFunc(t *testing.T) {
+	const sample = `
+transform = "trim"
+steps     = ["upper", "upper"]
+`
+	type Transform func(string) string
+
+	c := struct {
+		Transform Transform
+		Steps     []Step
+	}{}
+	d := NewDecoder(strings.NewReader(sample))
+	d.RegisterFunc(reflect.TypeOf(Transform(nil)), map[string]interface{}{
+		"trim": Transform(strings.TrimSpace),
+	})
+	d.RegisterFunc(reflect.TypeOf((*Step)(nil)).Elem(), map[string]interface{}{
+		"upper": upperStep{},
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Transform == nil || c.Transform(" toml ") != "toml" {
+		t.Errorf("transform not decoded properly")
+	}
+	if len(c.Steps) != 2 || c.Steps[0].Run("toml") != "TOML" {
+		t.Errorf("steps not decoded properly: %v", c.Steps)
+	}
+
+	d = NewDecoder(strings.NewReader(`transform = "unknown"`))
+	d.RegisterFunc(reflect.TypeOf(Transform(nil)), map[string]interface{}{
+		"trim": Transform(strings.TrimSpace),
+	})
+	if err := d.Decode(&c); err == nil {
+		t.Errorf("unknown name not detected")
+	}
+}
+
+func TestDecodeDottedKeys(t *testing.T) {
+	const sample = `
+a.b.c = 1
+a.b.d = "foo"
+a.e   = true
+
+[x]
+y.z = 3.14
+`
+	c := struct {
+		A struct {
+			B struct {
+				C int
+				D string
+			}
+			E bool
+		}
+		X *struct {
+			Y struct {
+				Z float64
+			}
+		}
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.A.B.C != 1 || c.A.B.D != "foo" || !c.A.E {
+		t.Errorf("dotted keys not decoded properly: %+v", c.A)
+	}
+	if c.X == nil || c.X.Y.Z != 3.14 {
+		t.Errorf("dotted keys in table not decoded properly: %+v", c.X)
+	}
+}
+
+func TestDecodeStrictFile(t *testing.T) {
+	var p Package
+	if err := DecodeStrictFile("testdata/package.toml", &p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := struct {
+		Name    string
+		Version string
+	}{}
+	err := DecodeStrictFile("testdata/package.toml", &c)
+	var uke *UnknownKeysError
+	if !errors.As(err, &uke) {
+		t.Fatalf("unknown keys not reported: %v", err)
+	}
+	if len(uke.Keys) < 2 {
+		t.Errorf("all unknown keys should be reported: %v", uke.Keys)
+	}
+	if !strings.HasPrefix(err.Error(), "testdata/package.toml: ") {
+		t.Errorf("file not found in error: %s", err)
+	}
+	if err := DecodeFile("testdata/package.toml", &c); errors.As(err, &uke) {
+		t.Errorf("DecodeFile should stop at the first unknown key: %s", err)
+	}
+	if err := DecodeStrictFile("testdata/missing.toml", &p); err == nil {
+		t.Errorf("missing file not detected")
+	}
+}
+
+func TestDecodeSkipEmpty(t *testing.T) {
+	const sample = `
+name    = ""
+version = "1.0.0"
+port    = 0
+debug   = false
+tags    = []
+`
+	c := struct {
+		Name    string
+		Version string
+		Port    int
+		Debug   bool
+		Tags    []string
+	}{
+		Name:  "toml",
+		Port:  8080,
+		Debug: true,
+		Tags:  []string{"config"},
+	}
+	d := NewDecoder(strings.NewReader(sample))
+	d.SetSkipEmpty(true)
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "toml" || c.Port != 8080 || !c.Debug || len(c.Tags) != 1 {
+		t.Errorf("non zero fields overwritten by empty values: %+v", c)
+	}
+	if c.Version != "1.0.0" {
+		t.Errorf("version not decoded: want %s, got %s", "1.0.0", c.Version)
+	}
+}
+
+func TestDecodeHeterogeneousArrayTable(t *testing.T) {
+	const sample = `
+[[plugin]]
+name = "auth"
+keys = ["a", "b"]
+
+[[plugin]]
+name    = "cache"
+size    = 64
+[plugin.backend]
+kind = "memory"
+
+[[plugin]]
+enabled = false
+`
+	c := struct {
+		Plugin []map[string]interface{}
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"name": "auth", "keys": []interface{}{"a", "b"}},
+		{"name": "cache", "size": int64(64), "backend": map[string]interface{}{"kind": "memory"}},
+		{"enabled": false},
+	}
+	if !reflect.DeepEqual(c.Plugin, want) {
+		t.Errorf("array of tables not decoded properly:\nwant: %v\ngot:  %v", want, c.Plugin)
+	}
+
+	m := make(map[string]interface{})
+	if err := Decode(strings.NewReader(sample), &m); err != nil {
+		t.Fatal(err)
+	}
+	items, ok := m["plugin"].([]interface{})
+	if !ok || len(items) != len(want) {
+		t.Fatalf("array of tables not decoded properly: %v", m["plugin"])
+	}
+	for i := range items {
+		if !reflect.DeepEqual(items[i], want[i]) {
+			t.Errorf("item %d not decoded properly:\nwant: %v\ngot:  %v", i, want[i], items[i])
+		}
+	}
+}
+
+type Color int8
+
+const (
+	Red Color = iota
+	Green
+	Blue
+)
+
+func TestDecodeEnum(t *testing.T) {
+	const sample = `
+background = 2
+foreground = "green"
+border     = "red"
+`
+	c := struct {
+		Background Color
+		Foreground Color
+		Border     Color
+	}{
+		Border: Blue,
+	}
+	d := NewDecoder(strings.NewReader(sample))
+	d.RegisterFunc(reflect.TypeOf(Red), map[string]interface{}{
+		"red":   Red,
+		"green": 1,
+		"blue":  Blue,
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Background != Blue {
+		t.Errorf("background: want %d, got %d", Blue, c.Background)
+	}
+	if c.Foreground != Green {
+		t.Errorf("foreground: want %d, got %d", Green, c.Foreground)
+	}
+	if c.Border != Red {
+		t.Errorf("border: want %d, got %d", Red, c.Border)
+	}
+
+	err := Decode(strings.NewReader("background = 300"), &c)
+	if err == nil {
+		t.Errorf("out of range value not detected")
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	const sample = `
+[server]
+host = "localhost"
+port = 99999999999999999999
+`
+	c := struct {
+		Server struct {
+			Host string
+			Port int
+		}
+	}{}
+	err := Decode(strings.NewReader(sample), &c)
+	if err == nil {
+		t.Fatalf("invalid integer not detected")
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("unexpected error type %T", err)
+	}
+	if want := "server.port"; de.Key != want {
+		t.Errorf("key: want %s, got %s", want, de.Key)
+	}
+	if want := (Position{Line: 4, Column: 8}); de.Pos != want {
+		t.Errorf("position: want %s, got %s", want, de.Pos)
+	}
+	if !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("strconv error not wrapped: %s", err)
+	}
+}
+
+func TestDecodeUnsigned(t *testing.T) {
+	data := []struct {
+		Input string
+		Want  uint64
+	}{
+		{Input: "18446744073709551615", Want: math.MaxUint64},
+		{Input: "0xffff_ffff_ffff_ffff", Want: math.MaxUint64},
+		{Input: "9223372036854775808", Want: math.MaxInt64 + 1},
+		{Input: "+42", Want: 42},
+		{Input: "0o755", Want: 0755},
+	}
+	for _, d := range data {
+		var c struct {
+			Value uint64
+		}
+		if err := Decode(strings.NewReader("value = "+d.Input), &c); err != nil {
+			t.Errorf("%s: unexpected error: %s", d.Input, err)
+			continue
+		}
+		if c.Value != d.Want {
+			t.Errorf("%s: want %d, got %d", d.Input, d.Want, c.Value)
+		}
+	}
+	for _, str := range []string{"-1", "18446744073709551616"} {
+		var c struct {
+			Value uint64
+		}
+		if err := Decode(strings.NewReader("value = "+str), &c); err == nil {
+			t.Errorf("%s: invalid unsigned integer decoded: %d", str, c.Value)
+		}
+	}
+	var c struct {
+		Value uint8
+	}
+	if err := Decode(strings.NewReader("value = 256"), &c); err == nil {
+		t.Errorf("out of range value decoded into uint8: %d", c.Value)
+	}
+}
+
+func TestDecodeFieldResolver(t *testing.T) {
+	const sample = `
+pkg-name = "toml"
+version  = "1.0.0"
+
+[maintainer]
+login = "midbel"
+`
+	type Owner struct {
+		Name string
+	}
+	c := struct {
+		Package string
+		Version string
+		Owner   Owner
+	}{}
+	schema := map[string]string{
+		"pkg-name":   "Package",
+		"maintainer": "Owner",
+		"login":      "Name",
+	}
+	d := NewDecoder(strings.NewReader(sample))
+	d.SetFieldResolver(func(typ reflect.Type, key string) (string, bool) {
+		name, ok := schema[key]
+		return name, ok
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Package != "toml" || c.Version != "1.0.0" || c.Owner.Name != "midbel" {
+		t.Errorf("keys not resolved properly: %+v", c)
+	}
+}
+
+func TestDecodeFieldResolverEmbedded(t *testing.T) {
+	type Embedded struct {
+		X int
+	}
+	type embedded struct {
+		Z int
+	}
+	c := struct {
+		*Embedded
+		*embedded
+		Y int
+	}{}
+	schema := map[string]string{
+		"x": "X",
+		"y": "Y",
+		"z": "Z",
+	}
+	d := NewDecoder(strings.NewReader("x = 1\ny = 2\n"))
+	d.SetFieldResolver(func(typ reflect.Type, key string) (string, bool) {
+		name, ok := schema[key]
+		return name, ok
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Embedded == nil || c.X != 1 || c.Y != 2 {
+		t.Errorf("field of nil embedded pointer not resolved: %+v", c)
+	}
+	d = NewDecoder(strings.NewReader("z = 3\n"))
+	d.SetFieldResolver(func(typ reflect.Type, key string) (string, bool) {
+		name, ok := schema[key]
+		return name, ok
+	})
+	if err := d.Decode(&c); err == nil {
+		t.Errorf("field of unexported embedded pointer should not be resolved")
+	}
+}
+
+func TestDecodeMatchKey(t *testing.T) {
+	const sample = `
+http_port = 8080
+MaxConns  = 100
+version   = "1.0.0"
+`
+	c := struct {
+		HTTPPort int
+		MaxConns int
+		Version  string
+		Ignored  string `toml:"-"`
+	}{}
+	d := NewDecoder(strings.NewReader(sample))
+	d.MatchKey(func(f reflect.StructField, key string) bool {
+		key = strings.ReplaceAll(key, "_", "")
+		return strings.EqualFold(f.Name, key)
+	})
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.HTTPPort != 8080 || c.MaxConns != 100 || c.Version != "1.0.0" {
+		t.Errorf("keys not matched properly: %+v", c)
+	}
+	if err := Decode(strings.NewReader(sample), &c); err == nil {
+		t.Errorf("keys should not be matched without matcher")
+	}
+
+	d = NewDecoder(strings.NewReader("ignored = \"value\""))
+	d.MatchKey(func(f reflect.StructField, key string) bool {
+		return strings.EqualFold(f.Name, key)
+	})
+	if err := d.Decode(&c); err == nil {
+		t.Errorf("field with - tag should not be matched")
+	}
+
+	r := struct {
+		Port     int
+		HTTPPort int
+	}{}
+	d = NewDecoder(strings.NewReader("http_port = 80"))
+	d.SetFieldResolver(func(_ reflect.Type, key string) (string, bool) {
+		return "Port", key == "http_port"
+	})
+	d.MatchKey(func(f reflect.StructField, key string) bool {
+		return strings.EqualFold(f.Name, strings.ReplaceAll(key, "_", ""))
+	})
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Port != 80 || r.HTTPPort != 0 {
+		t.Errorf("resolver should take precedence over matcher: %+v", r)
+	}
+}
+
+func TestDecodeDottedKeysAndHeaders(t *testing.T) {
+	const sample = `
+a.b = 1
+
+[a.c]
+d = 2
+
+[x.y]
+z = 3
+
+[x]
+w = 4
+`
+	c := struct {
+		A struct {
+			B int
+			C struct {
+				D int
+			}
+		}
+		X struct {
+			W int
+			Y struct {
+				Z int
+			}
+		}
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.A.B != 1 || c.A.C.D != 2 {
+		t.Errorf("dotted keys and sub table not merged: %+v", c.A)
+	}
+	if c.X.W != 4 || c.X.Y.Z != 3 {
+		t.Errorf("implicit table and header not merged: %+v", c.X)
+	}
+}
+
+func TestDecodeDottedKeysEquivalent(t *testing.T) {
+	type Server struct {
+		Name string
+		HTTP *struct {
+			Port  int
+			Hosts []string
+		} `toml:"http"`
+	}
+	docs := []string{
+		"server.name = \"web\"\nserver.http.port = 8080\nserver.http.hosts = [\"a\", \"b\"]",
+		"[server]\nname = \"web\"\nhttp.port = 8080\nhttp.hosts = [\"a\", \"b\"]",
+		"[server]\nname = \"web\"\n[server.http]\nport = 8080\nhosts = [\"a\", \"b\"]",
+		"[server.http]\nport = 8080\nhosts = [\"a\", \"b\"]\n[server]\nname = \"web\"",
+	}
+	for _, doc := range docs {
+		var c struct {
+			Server Server
+		}
+		if err := Decode(strings.NewReader(doc), &c); err != nil {
+			t.Errorf("%q: unexpected error: %s", doc, err)
+			continue
+		}
+		s := c.Server
+		if s.Name != "web" || s.HTTP == nil || s.HTTP.Port != 8080 || len(s.HTTP.Hosts) != 2 {
+			t.Errorf("%q: server not decoded properly: %+v", doc, s)
+		}
+	}
+}
+
+func TestDecodeMapOfStructs(t *testing.T) {
+	const sample = `
+[servers.web]
+port = 80
+
+[servers.db]
+host = "db.local"
+port = 5432
+
+[[replicas.db]]
+port = 5433
+
+[[replicas.db]]
+port = 5434
+`
+	type Server struct {
+		Host string
+		Port int
+	}
+	c := struct {
+		Servers  map[string]Server
+		Replicas map[string][]*Server
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Server{
+		"web": {Port: 80},
+		"db":  {Host: "db.local", Port: 5432},
+	}
+	if !reflect.DeepEqual(c.Servers, want) {
+		t.Errorf("servers not decoded properly: want %+v, got %+v", want, c.Servers)
+	}
+	if rs := c.Replicas["db"]; len(rs) != 2 || rs[0].Port != 5433 || rs[1].Port != 5434 {
+		t.Errorf("replicas not decoded properly: %+v", c.Replicas)
+	}
+}
+
+func TestDecodeSection(t *testing.T) {
+	const sample = `
+name = "toml"
+
+[server]
+host = "localhost"
+
+[server.logging]
+level = "debug"
+file  = "/var/log/toml.log"
+
+[[plugin]]
+name = "auth"
+`
+	logging := struct {
+		Level string
+		File  string
+	}{}
+	if err := DecodeSection(strings.NewReader(sample), "server.logging", &logging); err != nil {
+		t.Fatal(err)
+	}
+	if logging.Level != "debug" || logging.File != "/var/log/toml.log" {
+		t.Errorf("section not decoded properly: %+v", logging)
+	}
+	for _, path := range []string{"client", "server.host", "plugin"} {
+		var m map[string]interface{}
+		if err := DecodeSection(strings.NewReader(sample), path, &m); err == nil {
+			t.Errorf("%s: invalid section not detected", path)
+		}
+	}
+}
+
+func TestDecodeSectionReuse(t *testing.T) {
+	const sample = `
+[server]
+host = "localhost"
+port = "http"
+`
+	d := NewDecoder(strings.NewReader(sample))
+	var m map[string]interface{}
+	if err := d.DecodeSection("server.logging", &m); err == nil {
+		t.Fatalf("invalid section not detected")
+	}
+	if len(d.path) != 0 {
+		t.Errorf("path not reset after error: %v", d.path)
+	}
+	d.r = strings.NewReader(sample)
+	server := struct {
+		Host string
+		Port int
+	}{}
+	err := d.DecodeSection("server", &server)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := "server.port"; de.Key != want {
+		t.Errorf("key: want %s, got %s", want, de.Key)
+	}
+}
+
+func TestDecodeContext(t *testing.T) {
+	var p Package
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := DecodeContext(ctx, strings.NewReader(`package = "toml"`), &p)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("cancellation not detected: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if err := DecodeContext(ctx, strings.NewReader(`package = "toml"`), &p); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.Name != "toml" {
+		t.Errorf("name: want %s, got %s", "toml", p.Name)
+	}
+}
+
+func TestDecodeTypedValue(t *testing.T) {
+	const sample = `
+count   = 1
+ratio   = 1.0
+release = "2019-10-24"
+date    = 2019-10-24
+tags    = ["toml"]
+owner   = {name = "midbel"}
+`
+	c := struct {
+		Count   TypedValue
+		Ratio   TypedValue
+		Release TypedValue
+		Date    TypedValue
+		Tags    TypedValue
+		Owner   TypedValue
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		TypedValue
+		Name  string
+		Value interface{}
+	}{
+		{TypedValue: c.Count, Name: "integer", Value: int64(1)},
+		{TypedValue: c.Ratio, Name: "float", Value: float64(1)},
+		{TypedValue: c.Release, Name: "string", Value: "2019-10-24"},
+		{TypedValue: c.Date, Name: "date", Value: time.Date(2019, 10, 24, 0, 0, 0, 0, time.UTC)},
+		{TypedValue: c.Tags, Name: "array", Value: []interface{}{"toml"}},
+		{TypedValue: c.Owner, Name: "table", Value: map[string]interface{}{"name": "midbel"}},
+	}
+	for _, d := range data {
+		if got := d.TypeName(); got != d.Name {
+			t.Errorf("type: want %s, got %s", d.Name, got)
+		}
+		if !reflect.DeepEqual(d.TypedValue.Value, d.Value) {
+			t.Errorf("value: want %v (%[1]T), got %v (%[2]T)", d.Value, d.TypedValue.Value)
+		}
+	}
+}
+
+func TestDecodeSplit(t *testing.T) {
+	const sample = `
+tags    = "toml, parser ,decoder"
+ports   = "80|443"
+authors = ["midbel"]
+empty   = ""
+`
+	c := struct {
+		Tags    []string `toml:"tags,split=,"`
+		Ports   []int    `toml:"ports,split=|"`
+		Authors []string `toml:"authors,split=,"`
+		Empty   []string `toml:"empty,split=,"`
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"toml", "parser", "decoder"}; !reflect.DeepEqual(c.Tags, want) {
+		t.Errorf("tags: want %q, got %q", want, c.Tags)
+	}
+	if want := []int{80, 443}; !reflect.DeepEqual(c.Ports, want) {
+		t.Errorf("ports: want %v, got %v", want, c.Ports)
+	}
+	if want := []string{"midbel"}; !reflect.DeepEqual(c.Authors, want) {
+		t.Errorf("authors: want %q, got %q", want, c.Authors)
+	}
+	if len(c.Empty) != 0 {
+		t.Errorf("empty: want no values, got %q", c.Empty)
+	}
+
+	p := struct {
+		Ports []int `toml:"ports,split=,"`
+	}{}
+	if err := Decode(strings.NewReader(`ports = "80,http"`), &p); err == nil {
+		t.Errorf("invalid integer not detected")
+	}
+
+	k := struct {
+		Tags []string `toml:"tags,split=,"`
+	}{
+		Tags: []string{"default"},
+	}
+	d := NewDecoder(strings.NewReader(`tags = ""`))
+	d.SetSkipEmpty(true)
+	if err := d.Decode(&k); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"default"}; !reflect.DeepEqual(k.Tags, want) {
+		t.Errorf("empty string should be skipped: want %q, got %q", want, k.Tags)
+	}
+
+	u := struct {
+		Tags splitList `toml:"tags,split=,"`
+	}{}
+	if err := Decode(strings.NewReader(`tags = "a,b"`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if want := (splitList{"a;b"}); !reflect.DeepEqual(u.Tags, want) {
+		t.Errorf("unmarshaler not used: want %q, got %q", want, u.Tags)
+	}
+}
+
+// splitList decodes a string with its own separator.
+type splitList []string
+
+func (s *splitList) UnmarshalTOML(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("%T: not a string", v)
+	}
+	*s = splitList{strings.ReplaceAll(str, ",", ";")}
+	return nil
+}
+
+func TestDecodeTagOptions(t *testing.T) {
+	const sample = `
+name  = "toml"
+port  = 8080
+"-"   = "dash"
+debug = true
+`
+	c := struct {
+		Name  string `toml:"name,omitempty"`
+		Port  int    `toml:",omitempty"`
+		Dash  string `toml:"-,"`
+		Debug bool   `toml:"debug, omitempty"`
+		Skip  string `toml:"-"`
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "toml" || c.Port != 8080 || c.Dash != "dash" || !c.Debug || c.Skip != "" {
+		t.Errorf("fields not decoded properly: %+v", c)
+	}
+}
+
+func TestDecodeErrorPosition(t *testing.T) {
+	const sample = `
+name  = "toml"
+ports = [80, 443, "https"]
+
+[server]
+host  = "localhost"
+port  = "http"
+`
+	c := struct {
+		Name   string
+		Ports  []int
+		Server struct {
+			Host string
+			Port int
+		}
+	}{}
+	err := Decode(strings.NewReader(sample), &c)
+	if err == nil || !strings.HasPrefix(err.Error(), "3:19 ports: ") {
+		t.Errorf("position of array element not reported: %v", err)
+	}
+	err = Decode(strings.NewReader(strings.Replace(sample, `"https"`, "8443", 1)), &c)
+	if err == nil || !strings.HasPrefix(err.Error(), "7:9 server.port: ") {
+		t.Errorf("position of value not reported: %v", err)
+	}
+}
+
+func TestDecodeFileError(t *testing.T) {
+	w, err := ioutil.TempFile("", "decode-*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(w.Name())
+	w.WriteString("port = \"http\"\n")
+	w.Close()
+
+	c := struct {
+		Port int
+	}{}
+	err = DecodeFile(w.Name(), &c)
+	if err == nil {
+		t.Fatalf("invalid type not detected")
+	}
+	if !strings.HasPrefix(err.Error(), w.Name()+": 1:8 port: ") {
+		t.Errorf("file name not found in error: %s", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Errorf("decode error not wrapped: %T", err)
+	}
+}
+
+type Backend interface {
+	Name() string
+}
+
+type memoryBackend struct {
+	Kind string
+	Size int
+}
+
+func (m *memoryBackend) Name() string {
+	return m.Kind
+}
+
+func TestDecodePrefilledInterface(t *testing.T) {
+	const sample = `
+[backend]
+size = 128
+
+[extra]
+level = "debug"
+`
+	c := struct {
+		Backend
+		Extra interface{}
+	}{
+		Backend: &memoryBackend{Kind: "memory", Size: 64},
+		Extra:   map[string]interface{}{"keep": true},
+	}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := c.Backend.(*memoryBackend)
+	if !ok {
+		t.Fatalf("backend replaced by %T", c.Backend)
+	}
+	if b.Kind != "memory" || b.Size != 128 {
+		t.Errorf("backend not decoded properly: %+v", b)
+	}
+	want := map[string]interface{}{"keep": true, "level": "debug"}
+	if !reflect.DeepEqual(c.Extra, want) {
+		t.Errorf("extra: want %v, got %v", want, c.Extra)
+	}
+
+	c.Backend = nil
+	if err := Decode(strings.NewReader(sample), &c); err == nil {
+		t.Errorf("nil interface with methods not detected")
+	}
+}
+
+func TestDecodeSpecialFloats(t *testing.T) {
+	const sample = `
+pinf = +inf
+ninf = -inf
+nan  = nan
+`
+	var f64 struct {
+		Pinf float64
+		Ninf float64
+		Nan  float64
+	}
+	if err := Decode(strings.NewReader(sample), &f64); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(f64.Pinf, 1) || !math.IsInf(f64.Ninf, -1) || !math.IsNaN(f64.Nan) {
+		t.Errorf("special floats not decoded properly: %+v", f64)
+	}
+	var f32 struct {
+		Pinf float32
+		Ninf float32
+		Nan  float32
+	}
+	if err := Decode(strings.NewReader(sample), &f32); err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(float64(f32.Pinf), 1) || !math.IsInf(float64(f32.Ninf), -1) || !math.IsNaN(float64(f32.Nan)) {
+		t.Errorf("special floats not decoded properly: %+v", f32)
+	}
+	var str struct {
+		Pinf string
+		Ninf string
+		Nan  string
+	}
+	if err := Decode(strings.NewReader(sample), &str); err != nil {
+		t.Fatal(err)
+	}
+	if str.Pinf != "+inf" || str.Ninf != "-inf" || str.Nan != "nan" {
+		t.Errorf("special floats not decoded properly: %+v", str)
+	}
+	for str, want := range map[string]float64{
+		"inf":  math.Inf(1),
+		"+inf": math.Inf(1),
+		"-inf": math.Inf(-1),
+		"nan":  math.NaN(),
+		"+nan": math.NaN(),
+		"-nan": math.NaN(),
+	} {
+		var (
+			doc = "value = " + str
+			f   struct {
+				Value float64
+			}
+		)
+		if err := Decode(strings.NewReader(doc), &f); err != nil {
+			t.Errorf("%s: unexpected error: %s", str, err)
+			continue
+		}
+		if math.IsNaN(want) && !math.IsNaN(f.Value) || !math.IsNaN(want) && f.Value != want {
+			t.Errorf("%s: want %f, got %f", str, want, f.Value)
+		}
+	}
+	for _, str := range []string{"+inf", "-inf", "nan", "+nan", "-nan"} {
+		doc := "value = " + str
+		var i struct {
+			Value int
+		}
+		if err := Decode(strings.NewReader(doc), &i); err == nil {
+			t.Errorf("%s: non finite float decoded into int", str)
+		}
+		var u struct {
+			Value uint
+		}
+		if err := Decode(strings.NewReader(doc), &u); err == nil {
+			t.Errorf("%s: non finite float decoded into uint", str)
+		}
+	}
+}
+
+func TestDecodeFirst(t *testing.T) {
+	w, err := ioutil.TempFile("", "decode-*.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(w.Name())
+	w.WriteString("port = \"http\"\n")
+	w.Close()
+
+	var p Package
+	file, err := DecodeFirst([]string{"testdata/missing.toml", "testdata/package.toml", w.Name()}, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "testdata/package.toml" || p.Name != "toml" {
+		t.Errorf("wrong file decoded: %s (%s)", file, p.Name)
+	}
+
+	c := struct {
+		Port int
+	}{}
+	file, err = DecodeFirst([]string{"testdata/missing.toml", w.Name(), "testdata/package.toml"}, &c)
+	if err == nil || file != w.Name() {
+		t.Errorf("search should stop at invalid file: %s (%v)", file, err)
+	}
+
+	_, err = DecodeFirst([]string{"testdata/missing.toml"}, &c)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing files not reported: %v", err)
+	}
+}
+
+type days int
+
+func (d *days) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		n, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil {
+			return err
+		}
+		*d = days(n)
+	case int64:
+		*d = days(v)
+	default:
+		return fmt.Errorf("unexpected type %T", v)
+	}
+	return nil
+}
+
+type labels []string
+
+func (s *labels) UnmarshalTOML(v interface{}) error {
+	vs, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected type %T", v)
+	}
+	for _, v := range vs {
+		*s = append(*s, strings.ToUpper(v.(string)))
+	}
+	return nil
+}
+
+func TestDecodeUnmarshaler(t *testing.T) {
+	const sample = `
+retention = "3d"
+history   = [1, "2d"]
+labels    = ["dev", "prod"]
+
+[[backup]]
+name      = "daily"
+retention = "7d"
+expire    = 30
+`
+	type Backup struct {
+		Name      string
+		Retention days
+		Expire    *days
+	}
+	c := struct {
+		Retention days
+		History   []days
+		Labels    labels
+		Backup    []Backup
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Retention != 3 {
+		t.Errorf("retention: want 3, got %d", c.Retention)
+	}
+	if len(c.History) != 2 || c.History[0] != 1 || c.History[1] != 2 {
+		t.Errorf("history: want [1 2], got %v", c.History)
+	}
+	if len(c.Labels) != 2 || c.Labels[0] != "DEV" || c.Labels[1] != "PROD" {
+		t.Errorf("labels: want [DEV PROD], got %v", c.Labels)
+	}
+	if len(c.Backup) != 1 || c.Backup[0].Retention != 7 || c.Backup[0].Expire == nil || *c.Backup[0].Expire != 30 {
+		t.Errorf("backup: unexpected value %+v", c.Backup)
+	}
+
+	err := Decode(strings.NewReader("retention = true"), &c)
+	if err == nil {
+		t.Fatalf("error of UnmarshalTOML not returned")
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Key != "retention" {
+		t.Errorf("error of UnmarshalTOML not wrapped: %v", err)
+	}
+}
+
+func TestDecodeTextUnmarshaler(t *testing.T) {
+	const sample = `
+addr  = "192.168.1.1"
+peers = ["10.0.0.1", "10.0.0.2"]
+hosts = "10.0.0.3, 10.0.0.4"
+`
+	c := struct {
+		Addr  net.IP
+		Peers []net.IP
+		Hosts []net.IP `toml:"hosts,split=,"`
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Addr.Equal(net.IPv4(192, 168, 1, 1)) {
+		t.Errorf("addr: want 192.168.1.1, got %s", c.Addr)
+	}
+	if len(c.Peers) != 2 || !c.Peers[1].Equal(net.IPv4(10, 0, 0, 2)) {
+		t.Errorf("peers: unexpected value %v", c.Peers)
+	}
+	if len(c.Hosts) != 2 || !c.Hosts[1].Equal(net.IPv4(10, 0, 0, 4)) {
+		t.Errorf("hosts: unexpected value %v", c.Hosts)
+	}
+	if err := Decode(strings.NewReader(`addr = "localhost"`), &c); err == nil {
+		t.Errorf("error of UnmarshalText not returned")
+	}
+}
+
+func TestDecodeLocalTime(t *testing.T) {
+	const sample = `
+time1 = 19:07:54
+time2 = 09:07:54
+time3 = 00:32:00.999999
+`
+	c := struct {
+		Time1 time.Time
+		Time2 time.Time
+		Time3 time.Time
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		Got  time.Time
+		Want time.Time
+	}{
+		{Got: c.Time1, Want: time.Date(0, 1, 1, 19, 7, 54, 0, time.UTC)},
+		{Got: c.Time2, Want: time.Date(0, 1, 1, 9, 7, 54, 0, time.UTC)},
+		{Got: c.Time3, Want: time.Date(0, 1, 1, 0, 32, 0, 999999000, time.UTC)},
+	}
+	for _, d := range data {
+		if !d.Got.Equal(d.Want) {
+			t.Errorf("time mismatched: want %s, got %s", d.Want, d.Got)
+		}
+	}
+
+	s := struct {
+		Time1 string
+		Time2 string
+		Time3 string
+	}{}
+	if err := Decode(strings.NewReader(sample), &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Time1 != "19:07:54" || s.Time2 != "09:07:54" || s.Time3 != "00:32:00.999999" {
+		t.Errorf("time not decoded into string: %+v", s)
+	}
+
+	i := struct {
+		Time1 int
+	}{}
+	if err := Decode(strings.NewReader(sample), &i); err == nil {
+		t.Errorf("time decoded into int")
+	}
+}
+
+func TestDecodeCivilTypes(t *testing.T) {
+	const sample = `
+date     = 1979-05-27
+time     = 07:32:00.999999
+datetime = 1979-05-27 07:32:00
+times    = [07:00:00, 19:30:00]
+`
+	c := struct {
+		Date     Date
+		Time     Time
+		DateTime DateTime
+		Times    []Time
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want := (Date{Year: 1979, Month: time.May, Day: 27}); c.Date != want {
+		t.Errorf("date mismatched: want %s, got %s", want, c.Date)
+	}
+	if want := (Time{Hour: 7, Minute: 32, Nanosecond: 999999000}); c.Time != want {
+		t.Errorf("time mismatched: want %s, got %s", want, c.Time)
+	}
+	if want := (DateTime{Date: Date{1979, time.May, 27}, Time: Time{Hour: 7, Minute: 32}}); c.DateTime != want {
+		t.Errorf("datetime mismatched: want %s, got %s", want, c.DateTime)
+	}
+	if len(c.Times) != 2 || c.Times[1] != (Time{Hour: 19, Minute: 30}) {
+		t.Errorf("times mismatched: %v", c.Times)
+	}
+
+	for _, doc := range []string{
+		"datetime = 1979-05-27T07:32:00Z",
+		"datetime = 1979-05-27T07:32:00-07:00",
+		"datetime = 1979-05-27",
+		"date = 07:32:00",
+		"time = 1979-05-27T07:32:00",
+	} {
+		if err := Decode(strings.NewReader(doc), &c); err == nil {
+			t.Errorf("%s: value decoded into wrong civil type", doc)
+		}
+	}
+}
+
+func TestDecodeRawTable(t *testing.T) {
+	c := struct {
+		Name   string
+		Script string   `toml:",raw"`
+		Hooks  []string `toml:"hook,raw"`
+	}{}
+	const valid = `
+name = "build"
+
+[script]
+# run the tests
+cmd  = "go test ./..."
+deps = ["go"]
+
+[[hook]]
+on = "push"
+
+[[hook]]
+on = "tag"
+`
+	if err := Decode(strings.NewReader(valid), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := "# run the tests\ncmd  = \"go test ./...\"\ndeps = [\"go\"]\n\n"
+	if c.Script != want {
+		t.Errorf("raw table mismatched: want %q, got %q", want, c.Script)
+	}
+	if len(c.Hooks) != 2 || c.Hooks[0] != "on = \"push\"\n\n" || c.Hooks[1] != "on = \"tag\"\n" {
+		t.Errorf("raw array of tables mismatched: %q", c.Hooks)
+	}
+
+	const crlf = "[script]\r\ncmd = \"make\"\r\n  [[hook]]\r\non = \"push\""
+	if err := Decode(strings.NewReader(crlf), &c); err != nil {
+		t.Fatal(err)
+	}
+	if want := "cmd = \"make\"\n"; c.Script != want {
+		t.Errorf("raw table mismatched: want %q, got %q", want, c.Script)
+	}
+	if len(c.Hooks) != 1 || c.Hooks[0] != "on = \"push\"" {
+		t.Errorf("raw array of tables mismatched: %q", c.Hooks)
+	}
+
+	for _, doc := range []string{
+		"script.cmd = \"make\"",
+		"[script.env]\npath = \"/bin\"",
+		"script = {cmd = \"make\"}",
+	} {
+		if err := Decode(strings.NewReader(doc), &c); err == nil {
+			t.Errorf("%s: table without source decoded as raw", doc)
+		}
+	}
+}
+
+func TestDecodeTimeSinceMidnight(t *testing.T) {
+	const sample = `
+start = 00:00:00
+end   = 23:59:59
+pause = 12:30:00.250
+label = 09:30:00
+`
+	c := struct {
+		Start time.Duration
+		End   time.Duration
+		Pause time.Duration
+		Label string
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	data := []struct {
+		Got  time.Duration
+		Want time.Duration
+	}{
+		{Got: c.Start, Want: 0},
+		{Got: c.End, Want: 23*time.Hour + 59*time.Minute + 59*time.Second},
+		{Got: c.Pause, Want: 12*time.Hour + 30*time.Minute + 250*time.Millisecond},
+	}
+	for _, d := range data {
+		if d.Got != d.Want {
+			t.Errorf("duration mismatched: want %s, got %s", d.Want, d.Got)
+		}
+	}
+	if c.Label != "09:30:00" {
+		t.Errorf("time not decoded into string: %s", c.Label)
+	}
+}
+
+func TestDecodeDuration(t *testing.T) {
+	const sample = `
+timeout  = "30s"
+retry    = "1h30m"
+interval = 1_000_000
+delays   = ["1s", "500ms"]
+`
+	c := struct {
+		Timeout  time.Duration
+		Retry    time.Duration
+		Interval time.Duration
+		Delays   []time.Duration
+	}{}
+	if err := Decode(strings.NewReader(sample), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Timeout != 30*time.Second || c.Retry != 90*time.Minute || c.Interval != time.Millisecond {
+		t.Errorf("durations not decoded properly: %+v", c)
+	}
+	if len(c.Delays) != 2 || c.Delays[1] != 500*time.Millisecond {
+		t.Errorf("durations not decoded properly: %v", c.Delays)
+	}
+	err := Decode(strings.NewReader(`timeout = "30 seconds"`), &c)
+	if err == nil || !strings.Contains(err.Error(), "duration(30 seconds)") {
+		t.Errorf("invalid duration not reported properly: %v", err)
+	}
+}
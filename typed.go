@@ -0,0 +1,61 @@
+package toml
+
+import (
+	"reflect"
+)
+
+// TypedValue holds a decoded value alongside with the type of the token that
+// produced it in the TOML document (TokInteger, TokFloat, TokBasic, TokDate,
+// ...). Arrays have the type TokBegArray and inline tables TokBegInline.
+type TypedValue struct {
+	Value interface{}
+	Type  rune
+}
+
+// TypeName gives the name of the TOML type of the value.
+func (v TypedValue) TypeName() string {
+	switch v.Type {
+	case TokBasic, TokLiteral, TokBasicMulti, TokLiteralMulti:
+		return "string"
+	case TokInteger:
+		return "integer"
+	case TokFloat:
+		return "float"
+	case TokBool:
+		return "boolean"
+	case TokDatetime:
+		return "datetime"
+	case TokDate:
+		return "date"
+	case TokTime:
+		return "time"
+	case TokBegArray:
+		return "array"
+	case TokBegInline:
+		return "table"
+	default:
+		return "unknown"
+	}
+}
+
+var typedValueType = reflect.TypeOf(TypedValue{})
+
+func (d *Decoder) decodeTyped(n Node, e reflect.Value) error {
+	var (
+		tv TypedValue
+		v  = reflect.ValueOf(&tv.Value).Elem()
+	)
+	switch n := n.(type) {
+	case *Literal:
+		tv.Type = n.token.Type
+	case *Array:
+		tv.Type = TokBegArray
+	case *Table:
+		tv.Type = TokBegInline
+	}
+	if err := d.decodeValue(n, v); err != nil {
+		return err
+	}
+	e.Set(reflect.ValueOf(tv))
+	return nil
+}